@@ -0,0 +1,1009 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/elimt/go-orchestrator/internal/client"
+	"github.com/elimt/go-orchestrator/internal/node"
+	"github.com/elimt/go-orchestrator/internal/spec"
+	"github.com/elimt/go-orchestrator/internal/task"
+	"github.com/google/uuid"
+)
+
+type command struct {
+	usage string
+	run   func(c *client.Client, output string, fs *flag.FlagSet, args []string) error
+	flags func(fs *flag.FlagSet)
+}
+
+var commands = map[string]command{
+	"run":      {usage: "run [flags] IMAGE [CMD...] | run -f SPEC", run: runTask, flags: runFlags},
+	"validate": {usage: "validate SPEC", run: validateSpec},
+	"ls":       {usage: "ls", run: listTasks},
+	"inspect":  {usage: "inspect TASK", run: inspectTask},
+	"stop":     {usage: "stop TASK...", run: stopTasks},
+	"logs":     {usage: "logs TASK", run: taskLogs},
+	"nodes":    {usage: "nodes", run: listNodes},
+	"queue":    {usage: "queue", run: showQueue},
+
+	"job ls":      {usage: "job ls", run: listJobs},
+	"job inspect": {usage: "job inspect JOB", run: inspectJob},
+	"job stop":    {usage: "job stop JOB...", run: stopJobs},
+
+	"cron create":  {usage: "cron create SPEC", run: createCronJob},
+	"cron ls":      {usage: "cron ls", run: listCronJobs},
+	"cron inspect": {usage: "cron inspect CRONJOB", run: inspectCronJob},
+	"cron rm":      {usage: "cron rm CRONJOB...", run: removeCronJobs},
+
+	"service create":   {usage: "service create SPEC", run: createService},
+	"service ls":       {usage: "service ls", run: listServices},
+	"service inspect":  {usage: "service inspect SERVICE", run: inspectService},
+	"service update":   {usage: "service update SPEC", run: updateService},
+	"service rollback": {usage: "service rollback SERVICE", run: rollbackService},
+	"service scale":    {usage: "service scale SERVICE REPLICAS", run: scaleService},
+	"service rm":       {usage: "service rm SERVICE...", run: removeServices},
+}
+
+var commandOrder = []string{
+	"run", "validate", "ls", "inspect", "stop", "logs", "nodes", "queue",
+	"job ls", "job inspect", "job stop",
+	"service create", "service ls", "service inspect", "service update", "service rollback",
+	"service scale", "service rm",
+	"cron create", "cron ls", "cron inspect", "cron rm",
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name, args := os.Args[1], os.Args[2:]
+	if (name == "job" || name == "service" || name == "cron") && len(args) > 0 {
+		name, args = name+" "+args[0], args[1:]
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		if name != "help" && name != "-h" && name != "--help" {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		}
+		usage()
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	manager := fs.String("manager", defaultManager(), "manager API address (env MANAGER_ADDR)")
+	output := fs.String("o", "table", "output format: table or json")
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s\n\nFlags:\n", program(), cmd.usage)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "unknown output format %q\n", *output)
+		os.Exit(2)
+	}
+
+	err := cmd.run(client.New(*manager), *output, fs, fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func program() string {
+	return filepath.Base(os.Args[0])
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s COMMAND [flags] [args]\n\nCommands:\n", program())
+	for _, name := range commandOrder {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s COMMAND -h' for the flags of a command.\n", program())
+}
+
+func defaultManager() string {
+	if addr := os.Getenv("MANAGER_ADDR"); addr != "" {
+		return addr
+	}
+	return "http://localhost:8888"
+}
+
+// stringList is a flag that may be given more than once.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+var runOpts struct {
+	file          string
+	name          string
+	env           stringList
+	ports         stringList
+	memory        int64
+	disk          int64
+	cpu           float64
+	cpuLimit      float64
+	restartPolicy string
+	maxRestarts   int
+	priority      string
+	preemption    string
+	tenant        string
+}
+
+func runFlags(fs *flag.FlagSet) {
+	fs.StringVar(&runOpts.file, "f", "", "submit the tasks of a YAML or JSON job spec file, - for stdin")
+	fs.StringVar(&runOpts.name, "name", "", "task name")
+	fs.Var(&runOpts.env, "e", "environment variable KEY=VALUE, may be repeated")
+	fs.Var(&runOpts.ports, "p", "port to expose, such as 80/tcp, may be repeated")
+	fs.Int64Var(&runOpts.memory, "memory", 0, "memory limit in bytes")
+	fs.Int64Var(&runOpts.disk, "disk", 0, "disk required in bytes")
+	fs.Float64Var(&runOpts.cpu, "cpu", 0, "CPU cores required, such as 0.5")
+	fs.Float64Var(&runOpts.cpuLimit, "cpu-limit", 0, "most CPU cores the task may use")
+	fs.StringVar(&runOpts.restartPolicy, "restart-policy", "", "container restart policy")
+	fs.IntVar(&runOpts.maxRestarts, "max-restarts", 0, "how often to restart the task when its health check fails")
+	fs.StringVar(&runOpts.priority, "priority", "",
+		"priority class: "+task.PriorityClassNames()+" (default "+task.DefaultPriorityClass+")")
+	fs.StringVar(&runOpts.tenant, "tenant", "", "tenant the task is queued for (default "+task.DefaultTenant+")")
+	fs.StringVar(&runOpts.preemption, "preemption-policy", "",
+		"whether the task may stop lower priority tasks to make room: preempt or never")
+}
+
+func runTask(c *client.Client, output string, fs *flag.FlagSet, args []string) error {
+	if runOpts.file != "" {
+		if len(args) > 0 {
+			return fmt.Errorf("an image can't be given with -f, the spec describes the tasks to run")
+		}
+		return submitSpec(c, output, runOpts.file)
+	}
+
+	if len(args) == 0 {
+		fs.Usage()
+		return fmt.Errorf("an image is required")
+	}
+	t, err := flagTask(args[0], args[1:])
+	if err != nil {
+		return err
+	}
+
+	created, err := c.Run(t)
+	if err != nil {
+		return err
+	}
+	if output == "json" {
+		return printJSON(created)
+	}
+	fmt.Println(created.ID)
+	return nil
+}
+
+func submitSpec(c *client.Client, output string, path string) error {
+	data, err := readFile(path)
+	if err != nil {
+		return err
+	}
+	job, err := c.SubmitJob(data)
+	if err != nil {
+		return specError("job", err)
+	}
+	if output == "json" {
+		return printJSON(job)
+	}
+	fmt.Println(job.ID)
+	return nil
+}
+
+func validateSpec(c *client.Client, output string, fs *flag.FlagSet, args []string) error {
+	if len(args) != 1 {
+		fs.Usage()
+		return fmt.Errorf("validate takes exactly one spec file")
+	}
+	data, err := readFile(args[0])
+	if err != nil {
+		return err
+	}
+	tasks, err := c.ValidateJob(data)
+	if err != nil {
+		return specError("job", err)
+	}
+	if output == "json" {
+		return printJSON(tasks)
+	}
+
+	fmt.Printf("%s is valid and describes %d tasks\n", args[0], len(tasks))
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tIMAGE\tCOMMAND\tCPU\tMEMORY\tDISK")
+	for _, t := range tasks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			t.Name, t.Image, dash(strings.Join(t.Cmd, " ")), cpu(t.CPU, t.CPULimit),
+			bytesize(t.Memory), bytesize(t.Disk))
+	}
+	return tw.Flush()
+}
+
+// specError lists each problem of an invalid job or service spec on its own
+// line.
+func specError(kind string, err error) error {
+	var verrs spec.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return err
+	}
+	msgs := []string{fmt.Sprintf("invalid %s spec", kind)}
+	for _, fe := range verrs {
+		msgs = append(msgs, "  "+fe.Error())
+	}
+	return errors.New(strings.Join(msgs, "\n"))
+}
+
+func readFile(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+func listTasks(c *client.Client, output string, fs *flag.FlagSet, args []string) error {
+	tasks, err := c.Tasks()
+	if err != nil {
+		return err
+	}
+	if output == "json" {
+		return printJSON(tasks)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tIMAGE\tSTATE\tPRIORITY\tHEALTH\tRESTARTS\tSTARTED")
+	for _, t := range tasks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			shortID(t.ID.String()), t.Name, t.Image, stateName(t.State), dash(t.PriorityClass), dash(t.Health),
+			len(t.Restarts), ago(t.StartTime))
+	}
+	return tw.Flush()
+}
+
+// flagTask builds the task to run from its image, command and the run
+// flags.
+func flagTask(image string, cmd []string) (task.Task, error) {
+	t := task.Task{
+		Name:             runOpts.name,
+		Image:            image,
+		Env:              runOpts.env,
+		Memory:           runOpts.memory,
+		Disk:             runOpts.disk,
+		CPU:              runOpts.cpu,
+		CPULimit:         runOpts.cpuLimit,
+		RestartPolicy:    runOpts.restartPolicy,
+		MaxRestarts:      runOpts.maxRestarts,
+		Tenant:           runOpts.tenant,
+		PreemptionPolicy: runOpts.preemption,
+	}
+	if len(cmd) > 0 {
+		t.Cmd = cmd
+	}
+	if len(runOpts.ports) > 0 {
+		t.ExposedPorts = nat.PortSet{}
+		for _, p := range runOpts.ports {
+			if !strings.Contains(p, "/") {
+				p += "/tcp"
+			}
+			t.ExposedPorts[nat.Port(p)] = struct{}{}
+		}
+	}
+	if err := t.SetPriorityClass(runOpts.priority); err != nil {
+		return task.Task{}, err
+	}
+	if err := task.ValidatePreemptionPolicy(runOpts.preemption); err != nil {
+		return task.Task{}, err
+	}
+	return t, nil
+}
+
+func inspectTask(c *client.Client, output string, fs *flag.FlagSet, args []string) error {
+	if len(args) != 1 {
+		fs.Usage()
+		return fmt.Errorf("inspect takes exactly one task")
+	}
+	t, err := c.ResolveTask(args[0])
+	if err != nil {
+		return err
+	}
+	if output == "json" {
+		return printJSON(t)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "ID:\t%s\n", t.ID)
+	fmt.Fprintf(tw, "Name:\t%s\n", t.Name)
+	if t.JobID != uuid.Nil {
+		fmt.Fprintf(tw, "Job:\t%s\n", t.JobID)
+	}
+	if t.ServiceID != uuid.Nil {
+		fmt.Fprintf(tw, "Service:\t%s\n", t.ServiceID)
+	}
+	fmt.Fprintf(tw, "State:\t%s\n", stateName(t.State))
+	if t.Reason != "" {
+		fmt.Fprintf(tw, "Reason:\t%s\n", t.Reason)
+	}
+	if len(t.DependsOn) > 0 {
+		fmt.Fprintf(tw, "Depends on:\t%s\n", dependencies(t.DependsOn))
+	}
+	fmt.Fprintf(tw, "Tenant:\t%s\n", dash(t.Tenant))
+	fmt.Fprintf(tw, "Priority:\t%s\n", priority(t))
+	fmt.Fprintf(tw, "Image:\t%s\n", t.Image)
+	fmt.Fprintf(tw, "Command:\t%s\n", dash(strings.Join(t.Cmd, " ")))
+	fmt.Fprintf(tw, "Env:\t%s\n", dash(strings.Join(t.Env, " ")))
+	fmt.Fprintf(tw, "Memory:\t%s\n", bytesize(t.Memory))
+	fmt.Fprintf(tw, "Disk:\t%s\n", bytesize(t.Disk))
+	fmt.Fprintf(tw, "CPU:\t%s\n", cpu(t.CPU, t.CPULimit))
+	writePlacement(tw, t)
+	fmt.Fprintf(tw, "Container:\t%s\n", dash(t.ContainerID))
+	fmt.Fprintf(tw, "Health:\t%s\n", dash(t.Health))
+	fmt.Fprintf(tw, "Restarts:\t%d\n", len(t.Restarts))
+	if t.MaxRetries > 0 {
+		fmt.Fprintf(tw, "Retries:\t%d of %d\n", t.Attempt, t.MaxRetries)
+	}
+	fmt.Fprintf(tw, "Started:\t%s\n", timestamp(t.StartTime))
+	fmt.Fprintf(tw, "Finished:\t%s\n", timestamp(t.FinishTime))
+	fmt.Fprintf(tw, "Exit code:\t%s\n", exitCode(t))
+	for _, r := range t.Restarts {
+		fmt.Fprintf(tw, "  %s\t%s\n", timestamp(r.Timestamp), r.Reason)
+	}
+	return tw.Flush()
+}
+
+func stopTasks(c *client.Client, output string, fs *flag.FlagSet, args []string) error {
+	if len(args) == 0 {
+		fs.Usage()
+		return fmt.Errorf("stop takes at least one task")
+	}
+	for _, ref := range args {
+		t, err := c.ResolveTask(ref)
+		if err != nil {
+			return err
+		}
+		err = c.Stop(t.ID)
+		if err != nil {
+			return fmt.Errorf("error stopping task %s: %w", t.ID, err)
+		}
+		fmt.Println(t.ID)
+	}
+	return nil
+}
+
+func taskLogs(c *client.Client, output string, fs *flag.FlagSet, args []string) error {
+	if len(args) != 1 {
+		fs.Usage()
+		return fmt.Errorf("logs takes exactly one task")
+	}
+	t, err := c.ResolveTask(args[0])
+	if err != nil {
+		return err
+	}
+	logs, err := c.Logs(t.ID)
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+	_, err = io.Copy(os.Stdout, logs)
+	return err
+}
+
+func listJobs(c *client.Client, output string, fs *flag.FlagSet, args []string) error {
+	jobs, err := c.Jobs()
+	if err != nil {
+		return err
+	}
+	if output == "json" {
+		return printJSON(jobs)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSTATE\tTASKS\tCREATED")
+	for _, j := range jobs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			shortID(j.ID.String()), j.Name, j.State, taskSummary(j.Tasks), ago(j.CreatedAt))
+	}
+	return tw.Flush()
+}
+
+// taskSummary counts tasks by state, e.g. "2 running, 1 failed".
+var stateNames = map[task.State]string{
+	task.Pending:   "pending",
+	task.Scheduled: "scheduled",
+	task.Completed: "completed",
+	task.Running:   "running",
+	task.Failed:    "failed",
+	task.Waiting:   "waiting",
+}
+
+// stateName returns the name of a task state, which the API reports by
+// number.
+func stateName(s task.State) string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("state %d", s)
+}
+
+func taskSummary(tasks []*task.Task) string {
+	counts := make(map[task.State]int)
+	for _, t := range tasks {
+		counts[t.State]++
+	}
+	var parts []string
+	order := []task.State{task.Running, task.Waiting, task.Pending, task.Scheduled, task.Completed, task.Failed}
+	for _, s := range order {
+		if counts[s] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[s], stateName(s)))
+		}
+	}
+	return dash(strings.Join(parts, ", "))
+}
+
+func inspectJob(c *client.Client, output string, fs *flag.FlagSet, args []string) error {
+	if len(args) != 1 {
+		fs.Usage()
+		return fmt.Errorf("job inspect takes exactly one job")
+	}
+	j, err := c.ResolveJob(args[0])
+	if err != nil {
+		return err
+	}
+	if output == "json" {
+		return printJSON(j)
+	}
+
+	fmt.Printf("ID:       %s\n", j.ID)
+	fmt.Printf("Name:     %s\n", j.Name)
+	fmt.Printf("State:    %s\n", j.State)
+	fmt.Printf("Created:  %s\n", timestamp(j.CreatedAt))
+	fmt.Printf("Tasks:    %s\n\n", taskSummary(j.Tasks))
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tIMAGE\tSTATE\tEXIT\tRETRIES\tRESTARTS\tSTARTED\tDEPENDS ON")
+	for _, t := range j.Tasks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d/%d\t%d\t%s\t%s\n",
+			shortID(t.ID.String()), dash(t.Name), dash(t.Image), stateName(t.State), exitCode(t),
+			t.Attempt, t.MaxRetries, len(t.Restarts), ago(t.StartTime), dash(dependencies(t.DependsOn)))
+	}
+	return tw.Flush()
+}
+
+// dependencies lists a task's dependencies, e.g. "migrate (completed)".
+func dependencies(deps []task.Dependency) string {
+	parts := make([]string, 0, len(deps))
+	for _, d := range deps {
+		parts = append(parts, fmt.Sprintf("%s (%s)", d.Task, d.Condition))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// exitCode is the exit code of a finished task, or "-" if it is still
+// running, waiting to, or finished without being started.
+func exitCode(t *task.Task) string {
+	if (t.State != task.Completed && t.State != task.Failed) || t.StartTime.IsZero() {
+		return "-"
+	}
+	return strconv.Itoa(t.ExitCode)
+}
+
+func stopJobs(c *client.Client, output string, fs *flag.FlagSet, args []string) error {
+	if len(args) == 0 {
+		fs.Usage()
+		return fmt.Errorf("job stop takes at least one job")
+	}
+	for _, ref := range args {
+		j, err := c.ResolveJob(ref)
+		if err != nil {
+			return err
+		}
+		_, err = c.StopJob(j.ID)
+		if err != nil {
+			return fmt.Errorf("error stopping job %s: %w", j.ID, err)
+		}
+		fmt.Println(j.ID)
+	}
+	return nil
+}
+
+func createCronJob(c *client.Client, output string, fs *flag.FlagSet, args []string) error {
+	if len(args) != 1 {
+		fs.Usage()
+		return fmt.Errorf("cron create takes exactly one spec file")
+	}
+	data, err := readFile(args[0])
+	if err != nil {
+		return err
+	}
+	cj, err := c.CreateCronJob(data)
+	if err != nil {
+		return specError("cron job", err)
+	}
+	if output == "json" {
+		return printJSON(cj)
+	}
+	fmt.Println(cj.ID)
+	return nil
+}
+
+func listCronJobs(c *client.Client, output string, fs *flag.FlagSet, args []string) error {
+	cronJobs, err := c.CronJobs()
+	if err != nil {
+		return err
+	}
+	if output == "json" {
+		return printJSON(cronJobs)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSCHEDULE\tPOLICY\tLAST RUN\tLAST STATE\tNEXT RUN")
+	for _, cj := range cronJobs {
+		last := "-"
+		if n := len(cj.Jobs); n > 0 {
+			last = string(cj.Jobs[n-1].State)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			shortID(cj.ID.String()), cj.Name, cj.Schedule, cj.ConcurrencyPolicy, ago(cj.LastRun), last,
+			timestamp(cj.NextRun))
+	}
+	return tw.Flush()
+}
+
+func inspectCronJob(c *client.Client, output string, fs *flag.FlagSet, args []string) error {
+	if len(args) != 1 {
+		fs.Usage()
+		return fmt.Errorf("cron inspect takes exactly one cron job")
+	}
+	cj, err := c.ResolveCronJob(args[0])
+	if err != nil {
+		return err
+	}
+	if output == "json" {
+		return printJSON(cj)
+	}
+
+	fmt.Printf("ID:        %s\n", cj.ID)
+	fmt.Printf("Name:      %s\n", cj.Name)
+	fmt.Printf("Schedule:  %s\n", cj.Schedule)
+	fmt.Printf("Policy:    %s\n", cj.ConcurrencyPolicy)
+	fmt.Printf("Created:   %s\n", timestamp(cj.CreatedAt))
+	fmt.Printf("Last run:  %s\n", timestamp(cj.LastRun))
+	fmt.Printf("Next run:  %s\n", timestamp(cj.NextRun))
+	if cj.Message != "" {
+		fmt.Printf("Message:   %s\n", cj.Message)
+	}
+	fmt.Println()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSTATE\tTASKS\tCREATED")
+	for _, j := range cj.Jobs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			shortID(j.ID.String()), j.Name, j.State, taskSummary(j.Tasks), ago(j.CreatedAt))
+	}
+	return tw.Flush()
+}
+
+func removeCronJobs(c *client.Client, output string, fs *flag.FlagSet, args []string) error {
+	if len(args) == 0 {
+		fs.Usage()
+		return fmt.Errorf("cron rm takes at least one cron job")
+	}
+	for _, ref := range args {
+		cj, err := c.ResolveCronJob(ref)
+		if err != nil {
+			return err
+		}
+		err = c.RemoveCronJob(cj.ID)
+		if err != nil {
+			return fmt.Errorf("error removing cron job %s: %w", cj.ID, err)
+		}
+		fmt.Println(cj.ID)
+	}
+	return nil
+}
+
+func createService(c *client.Client, output string, fs *flag.FlagSet, args []string) error {
+	if len(args) != 1 {
+		fs.Usage()
+		return fmt.Errorf("service create takes exactly one spec file")
+	}
+	data, err := readFile(args[0])
+	if err != nil {
+		return err
+	}
+	svc, err := c.CreateService(data)
+	if err != nil {
+		return specError("service", err)
+	}
+	if output == "json" {
+		return printJSON(svc)
+	}
+	fmt.Println(svc.ID)
+	return nil
+}
+
+func listServices(c *client.Client, output string, fs *flag.FlagSet, args []string) error {
+	services, err := c.Services()
+	if err != nil {
+		return err
+	}
+	if output == "json" {
+		return printJSON(services)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tIMAGE\tREPLICAS\tTASKS\tREVISION\tUPDATE\tUPDATED")
+	for _, svc := range services {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d/%d\t%s\t%d\t%s\t%s\n",
+			shortID(svc.ID.String()), svc.Name, svc.Template.Image, svc.Running, svc.Replicas,
+			taskSummary(svc.Tasks), svc.Revision, updateState(svc.UpdateStatus), ago(svc.UpdatedAt))
+	}
+	return tw.Flush()
+}
+
+func inspectService(c *client.Client, output string, fs *flag.FlagSet, args []string) error {
+	if len(args) != 1 {
+		fs.Usage()
+		return fmt.Errorf("service inspect takes exactly one service")
+	}
+	svc, err := c.ResolveService(args[0])
+	if err != nil {
+		return err
+	}
+	if output == "json" {
+		return printJSON(svc)
+	}
+
+	fmt.Printf("ID:        %s\n", svc.ID)
+	fmt.Printf("Name:      %s\n", svc.Name)
+	fmt.Printf("Image:     %s\n", svc.Template.Image)
+	fmt.Printf("Command:   %s\n", dash(strings.Join(svc.Template.Cmd, " ")))
+	fmt.Printf("Replicas:  %d running, %d desired\n", svc.Running, svc.Replicas)
+	fmt.Printf("Revision:  %d\n", svc.Revision)
+	fmt.Printf("Strategy:  max surge %d, max unavailable %d, delay %v, monitor %v, timeout %v, on failure %s\n",
+		svc.Update.MaxSurge, svc.Update.MaxUnavailable, svc.Update.Delay, svc.Update.Monitor,
+		svc.Update.Timeout, svc.Update.FailureAction)
+	if st := svc.UpdateStatus; st != nil {
+		fmt.Printf("Update:    %s, %d of %d updated, started %s\n",
+			st.State, st.Updated, svc.Replicas, ago(st.StartedAt))
+		if st.Message != "" {
+			fmt.Printf("           %s\n", st.Message)
+		}
+		if st.Reason != "" {
+			fmt.Printf("Reason:    %s\n", st.Reason)
+		}
+	}
+	fmt.Printf("Created:   %s\n", timestamp(svc.CreatedAt))
+	fmt.Printf("Updated:   %s\n\n", timestamp(svc.UpdatedAt))
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tREVISION\tSTATE\tHEALTH\tRESTARTS\tSTARTED")
+	for _, t := range svc.Tasks {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%d\t%s\n",
+			shortID(t.ID.String()), t.Name, t.Revision, stateName(t.State), dash(t.Health), len(t.Restarts),
+			ago(t.StartTime))
+	}
+	return tw.Flush()
+}
+
+// updateState is the state of a service's latest update, or "-" if it has
+// never been updated.
+func updateState(st *task.UpdateStatus) string {
+	if st == nil {
+		return "-"
+	}
+	return string(st.State)
+}
+
+func updateService(c *client.Client, output string, fs *flag.FlagSet, args []string) error {
+	if len(args) != 1 {
+		fs.Usage()
+		return fmt.Errorf("service update takes exactly one spec file")
+	}
+	data, err := readFile(args[0])
+	if err != nil {
+		return err
+	}
+	s, err := spec.ParseService(data)
+	if err != nil {
+		return err
+	}
+	svc, err := c.ResolveService(s.Name)
+	if err != nil {
+		return err
+	}
+	updated, err := c.UpdateService(svc.ID, data)
+	if err != nil {
+		return specError("service", err)
+	}
+	if output == "json" {
+		return printJSON(updated)
+	}
+	fmt.Println(updated.ID)
+	return nil
+}
+
+func rollbackService(c *client.Client, output string, fs *flag.FlagSet, args []string) error {
+	if len(args) != 1 {
+		fs.Usage()
+		return fmt.Errorf("service rollback takes exactly one service")
+	}
+	svc, err := c.ResolveService(args[0])
+	if err != nil {
+		return err
+	}
+	rolled, err := c.RollbackService(svc.ID)
+	if err != nil {
+		return fmt.Errorf("error rolling back service %s: %w", svc.ID, err)
+	}
+	if output == "json" {
+		return printJSON(rolled)
+	}
+	fmt.Println(rolled.ID)
+	return nil
+}
+
+func scaleService(c *client.Client, output string, fs *flag.FlagSet, args []string) error {
+	if len(args) != 2 {
+		fs.Usage()
+		return fmt.Errorf("service scale takes a service and a number of replicas")
+	}
+	replicas, err := strconv.Atoi(args[1])
+	if err != nil || replicas < 0 {
+		return fmt.Errorf("replicas must be a number of at least 0, got %q", args[1])
+	}
+	svc, err := c.ResolveService(args[0])
+	if err != nil {
+		return err
+	}
+	scaled, err := c.ScaleService(svc.ID, replicas)
+	if err != nil {
+		return fmt.Errorf("error scaling service %s: %w", svc.ID, err)
+	}
+	if output == "json" {
+		return printJSON(scaled)
+	}
+	fmt.Println(scaled.ID)
+	return nil
+}
+
+func removeServices(c *client.Client, output string, fs *flag.FlagSet, args []string) error {
+	if len(args) == 0 {
+		fs.Usage()
+		return fmt.Errorf("service rm takes at least one service")
+	}
+	for _, ref := range args {
+		svc, err := c.ResolveService(ref)
+		if err != nil {
+			return err
+		}
+		err = c.RemoveService(svc.ID)
+		if err != nil {
+			return fmt.Errorf("error removing service %s: %w", svc.ID, err)
+		}
+		fmt.Println(svc.ID)
+	}
+	return nil
+}
+
+func listNodes(c *client.Client, output string, fs *flag.FlagSet, args []string) error {
+	nodes, err := c.Nodes()
+	if err != nil {
+		return err
+	}
+	if output == "json" {
+		return printJSON(nodes)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw,
+		"NAME\tAPI\tSTATUS\tTASKS\tCPU ALLOCATED\tMEMORY ALLOCATED\tDISK ALLOCATED\tLAST HEARTBEAT\tLABELS")
+	for _, n := range nodes {
+		// Node memory is reported in KiB and disk in bytes.
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s / %d\t%s\t%s\t%s\t%s\n",
+			n.Name, n.API, n.Status, nodeTasks(n), cores(n.CPUAllocated), n.Cores,
+			allocation(int64(n.MemoryAllocated)*1024, int64(n.Memory)*1024),
+			allocation(int64(n.DiskAllocated), int64(n.Disk)), ago(n.LastHeartbeat), labels(n.Labels))
+	}
+	return tw.Flush()
+}
+
+func showQueue(c *client.Client, output string, fs *flag.FlagSet, args []string) error {
+	tenants, err := c.Queue()
+	if err != nil {
+		return err
+	}
+	if output == "json" {
+		return printJSON(tenants)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "TENANT\tWEIGHT\tPENDING\tOLDEST WAIT\tDISPATCHED\tAVERAGE WAIT")
+	for _, t := range tenants {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%d\t%s\n",
+			t.Tenant, t.Weight, t.Pending, wait(t.OldestWait), t.Dispatched, wait(t.AverageWait))
+	}
+	return tw.Flush()
+}
+
+// wait shows a time spent queued to the millisecond, or "-" for none.
+func wait(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+// priority shows a task's priority class and value, e.g. "high (1000)",
+// noting when it may not preempt other tasks.
+func priority(t *task.Task) string {
+	if t.PriorityClass == "" {
+		return "-"
+	}
+	p := fmt.Sprintf("%s (%d)", t.PriorityClass, t.Priority)
+	if t.PreemptionPolicy == task.PreemptNever {
+		p += ", never preempts"
+	}
+	return p
+}
+
+// cpu shows a task's CPU request and limit, e.g. "0.5 (limit 1)".
+func cpu(request float64, limit float64) string {
+	switch {
+	case request == 0 && limit == 0:
+		return "-"
+	case limit == 0:
+		return cores(request)
+	default:
+		return fmt.Sprintf("%s (limit %s)", cores(request), cores(limit))
+	}
+}
+
+// cores formats a number of cores to the thousandth without trailing
+// zeros, e.g. "0.25".
+func cores(n float64) string {
+	return strconv.FormatFloat(math.Round(n*1000)/1000, 'f', -1, 64)
+}
+
+// affinity lists affinity rules, e.g. "app == db, tier == web (soft,
+// weight 2)".
+// writePlacement writes the rules that decide where the task is placed.
+func writePlacement(tw io.Writer, t *task.Task) {
+	constraints := make([]string, 0, len(t.Constraints))
+	for _, c := range t.Constraints {
+		constraints = append(constraints, c.String())
+	}
+	fmt.Fprintf(tw, "Constraints:\t%s\n", dash(strings.Join(constraints, ", ")))
+	preferences := make([]string, 0, len(t.Preferences))
+	for _, p := range t.Preferences {
+		preferences = append(preferences, fmt.Sprintf("%s (weight %d)", p.Constraint, p.Weight))
+	}
+	fmt.Fprintf(tw, "Preferences:\t%s\n", dash(strings.Join(preferences, ", ")))
+	fmt.Fprintf(tw, "Labels:\t%s\n", labels(t.Labels))
+	fmt.Fprintf(tw, "Affinity:\t%s\n", affinity(t.Affinity))
+	fmt.Fprintf(tw, "Anti-affinity:\t%s\n", affinity(t.AntiAffinity))
+	spread := make([]string, 0, len(t.TopologySpread))
+	for _, r := range t.TopologySpread {
+		rule := fmt.Sprintf("%s across %s, max skew %d", r.Selector, r.Key, r.MaxSkew)
+		if r.Soft {
+			rule += " (soft)"
+		}
+		spread = append(spread, rule)
+	}
+	fmt.Fprintf(tw, "Spread:\t%s\n", dash(strings.Join(spread, "; ")))
+}
+
+func affinity(rules []task.AffinityRule) string {
+	parts := make([]string, 0, len(rules))
+	for _, r := range rules {
+		if r.Soft {
+			parts = append(parts, fmt.Sprintf("%s (soft, weight %d)", r.Selector, r.Weight))
+		} else {
+			parts = append(parts, r.Selector.String())
+		}
+	}
+	return dash(strings.Join(parts, ", "))
+}
+
+// labels lists labels sorted by key, e.g. "arch=amd64,zone=eu-1".
+func labels(l map[string]string) string {
+	pairs := make([]string, 0, len(l))
+	for k, v := range l {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return dash(strings.Join(pairs, ","))
+}
+
+// allocation shows how much of a node's capacity is allocated, e.g.
+// "512MiB / 7.6GiB".
+func allocation(allocated int64, capacity int64) string {
+	used := bytesize(allocated)
+	if allocated == 0 {
+		used = "0B"
+	}
+	return fmt.Sprintf("%s / %s", used, bytesize(capacity))
+}
+
+// nodeTasks prefers the task count the worker last reported over the
+// manager's own count of the tasks it placed there.
+func nodeTasks(n node.Node) int {
+	if n.Stats.TaskCount > 0 {
+		return n.Stats.TaskCount
+	}
+	return n.TaskCount
+}
+
+func printJSON(v interface{}) error {
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "  ")
+	return e.Encode(v)
+}
+
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func timestamp(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
+func ago(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return fmt.Sprintf("%v ago", time.Since(t).Round(time.Second))
+}
+
+func bytesize(b int64) string {
+	const unit = 1024
+	if b <= 0 {
+		return "-"
+	}
+	if b < unit {
+		return fmt.Sprintf("%dB", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -1,62 +1,190 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"strconv"
-
-	"github.com/elimt/go-orchestrator/internal/manager"
-	"github.com/elimt/go-orchestrator/internal/task"
-	"github.com/elimt/go-orchestrator/internal/worker"
-	"github.com/golang-collections/collections/queue"
-	"github.com/google/uuid"
+	"strings"
+	"time"
 )
 
+const usage = `Usage: %s [MODE] [flags]
+
+Modes:
+  manager   run a manager that schedules tasks onto the workers that join it
+  worker    run a worker that joins a manager and runs the tasks it is sent
+  all       run a manager and a worker in one process (default)
+
+Run '%s MODE -h' for the flags of a mode. Flags default to the environment
+variables named in their descriptions.
+`
+
 func main() {
-	fmt.Println("Starting Go Orchestrator worker")
+	mode, args := "all", os.Args[1:]
+	if len(args) > 0 && len(args[0]) > 0 && args[0][0] != '-' {
+		mode, args = args[0], args[1:]
+	}
 
-	whost := os.Getenv("WORKER_HTTP_HOST")
-	wport, _ := strconv.Atoi(os.Getenv("WORKER_HTTP_PORT"))
+	var err error
+	switch mode {
+	case "manager":
+		err = runManager(args)
+	case "worker":
+		err = runWorker(args)
+	case "all":
+		err = runAll(args)
+	default:
+		fmt.Fprintf(os.Stderr, usage, os.Args[0], os.Args[0])
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
 
-	mhost := os.Getenv("MANAGER_HTTP_HOST")
-	mport, _ := strconv.Atoi(os.Getenv("MANAGER_HTTP_PORT"))
+func runManager(args []string) error {
+	fs := newFlagSet("manager")
+	mc := managerFlags(fs, "")
+	dataDir := dataDirFlag(fs)
+	_ = fs.Parse(args)
+	mc.dataDir = *dataDir
 
-	w := worker.Worker{
-		Queue: *queue.New(),
-		DB:    make(map[uuid.UUID]*task.Task),
+	mapi, err := startManager(mc)
+	if err != nil {
+		return err
 	}
-	wapi := worker.API{Address: whost, Port: wport, Worker: &w}
+	mapi.Start()
+	return nil
+}
 
-	go w.RunTasks()
-	go w.CollectStats()
-	go wapi.Start()
+func runWorker(args []string) error {
+	fs := newFlagSet("worker")
+	wc := workerFlags(fs, "")
+	dataDir := dataDirFlag(fs)
+	fs.StringVar(&wc.managerURL, "manager", envOr("MANAGER_ADDR", "http://localhost:8888"),
+		"URL of the manager to join (MANAGER_ADDR)")
+	_ = fs.Parse(args)
+	wc.dataDir = *dataDir
+	wc.managerURL = withScheme(wc.managerURL)
+
+	wapi, err := startWorker(wc)
+	if err != nil {
+		return err
+	}
+	wapi.Start()
+	return nil
+}
 
-	workers := []string{fmt.Sprintf("%s:%d", whost, wport)}
-	m := manager.New(workers)
-	mapi := manager.API{Address: mhost, Port: mport, Manager: m}
+// runAll runs a manager and a worker that joins it in the same process.
+func runAll(args []string) error {
+	fs := newFlagSet("all")
+	mc := managerFlags(fs, "manager-")
+	wc := workerFlags(fs, "worker-")
+	dataDir := dataDirFlag(fs)
+	_ = fs.Parse(args)
+	mc.dataDir, wc.dataDir = *dataDir, *dataDir
 
-	go m.ProcessTasks()
-	go m.UpdateTasks()
+	mapi, err := startManager(mc)
+	if err != nil {
+		return err
+	}
+	wc.managerURL = advertiseURL(mapi.Address, mapi.Port, "localhost")
+	wapi, err := startWorker(wc)
+	if err != nil {
+		return err
+	}
 
+	go wapi.Start()
 	mapi.Start()
+	return nil
+}
 
-	// GenerateTasks(m)
-}
-
-// func GenerateTasks(m *manager.Manager) {
-// 	for i := 0; i < 3; i++ {
-// 		t := task.Task{
-// 			ID:    uuid.New(),
-// 			Name:  fmt.Sprintf("test-container-%d", i),
-// 			State: task.Scheduled,
-// 			Image: "strm/helloworld-http",
-// 		}
-// 		te := task.TaskEvent{
-// 			ID:    uuid.New(),
-// 			State: task.Running,
-// 			Task:  t,
-// 		}
-// 		m.AddTask(te)
-// 		m.SendWork()
-// 	}
-// }
+func newFlagSet(mode string) *flag.FlagSet {
+	fs := flag.NewFlagSet(mode, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s [flags]\n\nFlags:\n", os.Args[0], mode)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func dataDirFlag(fs *flag.FlagSet) *string {
+	return fs.String("data-dir", envOr("DATA_DIR", "."), "directory persistent stores are kept in (DATA_DIR)")
+}
+
+// hostPort returns the address from the host and port environment variables,
+// or def if they are not set.
+func hostPort(hostEnv string, portEnv string, def string) string {
+	if os.Getenv(portEnv) == "" {
+		return def
+	}
+	return net.JoinHostPort(os.Getenv(hostEnv), os.Getenv(portEnv))
+}
+
+func splitAddr(addr string) (string, int, error) {
+	host, p, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid listen address %q: %w", addr, err)
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port in listen address %q", addr)
+	}
+	return host, port, nil
+}
+
+// advertiseURL is the URL others can reach a server listening on host and
+// port at. A server listening on all interfaces is reached through
+// fallbackHost.
+func advertiseURL(host string, port int, fallbackHost string) string {
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = fallbackHost
+	}
+	return fmt.Sprintf("http://%s", net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+// withScheme makes a bare host:port into an http URL.
+func withScheme(addr string) string {
+	if addr == "" || strings.Contains(addr, "://") {
+		return addr
+	}
+	return "http://" + addr
+}
+
+// hostPortOf returns the host and port of a URL such as http://host:7777.
+func hostPortOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return u.Host
+}
+
+func envOr(name string, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+func intEnv(name string, def int) int {
+	i, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return i
+}
+
+// durationEnv parses the environment variable name as a duration such as
+// "10s", returning def when it is unset or invalid.
+func durationEnv(name string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return d
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elimt/go-orchestrator/internal/manager"
+)
+
+type managerConfig struct {
+	addr              string
+	dataDir           string
+	store             string
+	scheduler         string
+	processInterval   time.Duration
+	updateInterval    time.Duration
+	statsInterval     time.Duration
+	reconcileInterval time.Duration
+	tenantWeights     string
+}
+
+// managerFlags registers the manager's flags on fs. prefix is prepended to
+// the flags that a worker in the same process also has.
+func managerFlags(fs *flag.FlagSet, prefix string) *managerConfig {
+	c := managerConfig{}
+	fs.StringVar(&c.addr, prefix+"addr", hostPort("MANAGER_HTTP_HOST", "MANAGER_HTTP_PORT", "localhost:8888"),
+		"address the manager API listens on (MANAGER_HTTP_HOST, MANAGER_HTTP_PORT)")
+	fs.StringVar(&c.store, prefix+"store", envOr("MANAGER_STORE", "memory"),
+		"where the manager keeps tasks: memory or persistent (MANAGER_STORE)")
+	fs.StringVar(&c.scheduler, "scheduler", envOr("MANAGER_SCHEDULER", "roundrobin"),
+		"scheduler: roundrobin, leastloaded or epvm (MANAGER_SCHEDULER)")
+	fs.DurationVar(&c.processInterval, "process-interval",
+		durationEnv("MANAGER_PROCESS_INTERVAL", manager.DefaultProcessInterval),
+		"how often queued work is retried (MANAGER_PROCESS_INTERVAL)")
+	fs.DurationVar(&c.updateInterval, "update-interval",
+		durationEnv("MANAGER_UPDATE_INTERVAL", manager.DefaultUpdateInterval),
+		"how often task state is polled from workers (MANAGER_UPDATE_INTERVAL)")
+	fs.DurationVar(&c.statsInterval, "stats-interval",
+		durationEnv("MANAGER_STATS_INTERVAL", manager.DefaultStatsInterval),
+		"how often worker stats are polled (MANAGER_STATS_INTERVAL)")
+	fs.DurationVar(&c.reconcileInterval, "reconcile-interval",
+		durationEnv("MANAGER_RECONCILE_INTERVAL", manager.DefaultReconcileInterval),
+		"how often services are checked for missing replicas (MANAGER_RECONCILE_INTERVAL)")
+	fs.StringVar(&c.tenantWeights, "tenant-weights", os.Getenv("MANAGER_TENANT_WEIGHTS"),
+		"comma separated tenant=weight shares of dispatches, such as team-a=3,team-b=1; "+
+			"other tenants have a weight of 1 (MANAGER_TENANT_WEIGHTS)")
+	return &c
+}
+
+// startManager creates the manager and starts its background loops. The
+// returned API has not been started yet.
+func startManager(c *managerConfig) (*manager.API, error) {
+	host, port, err := splitAddr(c.addr)
+	if err != nil {
+		return nil, err
+	}
+	weights, err := parseWeights(c.tenantWeights)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Starting Go Orchestrator manager")
+	m, err := manager.New([]string{}, c.scheduler, c.store, c.dataDir)
+	if err != nil {
+		return nil, err
+	}
+	m.ProcessInterval = c.processInterval
+	m.UpdateInterval = c.updateInterval
+	m.StatsInterval = c.statsInterval
+	m.ReconcileInterval = c.reconcileInterval
+	m.Pending.Weights = weights
+
+	go m.ProcessTasks()
+	go m.UpdateTasks()
+	go m.UpdateNodeStats()
+	go m.CheckWorkers()
+	go m.ReconcileServices()
+	go m.RunCronJobs()
+
+	return &manager.API{Address: host, Port: port, Manager: m}, nil
+}
+
+// parseWeights parses tenant weights written as tenant=weight pairs
+// separated by commas.
+func parseWeights(s string) (map[string]int, error) {
+	weights := make(map[string]int)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		tenant, w, ok := strings.Cut(pair, "=")
+		weight, err := strconv.Atoi(strings.TrimSpace(w))
+		if !ok || strings.TrimSpace(tenant) == "" || err != nil || weight < 1 {
+			return nil, fmt.Errorf("invalid tenant weight %q, weights are written as tenant=N with N at least 1", pair)
+		}
+		weights[strings.TrimSpace(tenant)] = weight
+	}
+	return weights, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/elimt/go-orchestrator/internal/task"
+	"github.com/elimt/go-orchestrator/internal/worker"
+)
+
+type workerConfig struct {
+	addr        string
+	advertise   string
+	name        string
+	managerURL  string
+	dataDir     string
+	runtime     string
+	store       string
+	concurrency int
+	update      time.Duration
+	heartbeat   time.Duration
+	labels      string
+}
+
+// workerFlags registers the worker's flags on fs. prefix is prepended to the
+// flags that a manager in the same process also has.
+func workerFlags(fs *flag.FlagSet, prefix string) *workerConfig {
+	c := workerConfig{}
+	fs.StringVar(&c.addr, prefix+"addr", hostPort("WORKER_HTTP_HOST", "WORKER_HTTP_PORT", "localhost:7777"),
+		"address the worker API listens on (WORKER_HTTP_HOST, WORKER_HTTP_PORT)")
+	fs.StringVar(&c.store, prefix+"store", envOr("WORKER_STORE", "memory"),
+		"where the worker keeps tasks: memory or persistent (WORKER_STORE)")
+	fs.StringVar(&c.advertise, "advertise", os.Getenv("WORKER_ADVERTISE"),
+		"URL the manager reaches the worker at, defaults to the listen address (WORKER_ADVERTISE)")
+	fs.StringVar(&c.name, "name", os.Getenv("WORKER_NAME"),
+		"unique worker name, defaults to the advertised host and port (WORKER_NAME)")
+	fs.StringVar(&c.runtime, "runtime", envOr("WORKER_RUNTIME", task.DockerRuntime),
+		"runtime tasks run on: docker, process or fake (WORKER_RUNTIME)")
+	fs.IntVar(&c.concurrency, "concurrency", intEnv("WORKER_CONCURRENCY", worker.DefaultConcurrency),
+		"tasks started or stopped at once (WORKER_CONCURRENCY)")
+	fs.DurationVar(&c.update, prefix+"update-interval",
+		durationEnv("WORKER_UPDATE_INTERVAL", worker.DefaultUpdateInterval),
+		"how often running tasks are checked for exited containers (WORKER_UPDATE_INTERVAL)")
+	fs.DurationVar(&c.heartbeat, "heartbeat-interval", durationEnv("WORKER_HEARTBEAT_INTERVAL", 10*time.Second),
+		"how often the worker sends the manager a heartbeat (WORKER_HEARTBEAT_INTERVAL)")
+	fs.StringVar(&c.labels, "labels", os.Getenv("WORKER_LABELS"),
+		"comma separated key=value labels to advertise, such as zone=eu-1,disk=ssd (WORKER_LABELS)")
+	return &c
+}
+
+// startWorker creates the worker, reconciles it with its runtime, starts its
+// background loops and joins it to the manager. The returned API has not
+// been started yet.
+func startWorker(c *workerConfig) (*worker.API, error) {
+	host, port, err := splitAddr(c.addr)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := parseLabels(c.labels)
+	if err != nil {
+		return nil, err
+	}
+
+	advertise := withScheme(c.advertise)
+	if advertise == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "localhost"
+		}
+		advertise = advertiseURL(host, port, hostname)
+	}
+	name := c.name
+	if name == "" {
+		name = hostPortOf(advertise)
+	}
+
+	fmt.Printf("Starting Go Orchestrator worker %s\n", name)
+	rt, err := task.NewRuntime(c.runtime)
+	if err != nil {
+		return nil, err
+	}
+	w, err := worker.New(name, rt, c.store, c.dataDir)
+	if err != nil {
+		return nil, err
+	}
+	w.Concurrency = c.concurrency
+	w.UpdateInterval = c.update
+	w.Labels = labels
+
+	_, err = w.Reconcile(context.Background())
+	if err != nil {
+		fmt.Printf("Error reconciling worker with its runtime: %v\n", err)
+	}
+
+	go w.RunTasks()
+	go w.CollectStats()
+	go w.UpdateTasks()
+	go w.CheckHealth()
+	go w.Join(c.managerURL, advertise, c.heartbeat)
+
+	return &worker.API{Address: host, Port: port, Worker: w}, nil
+}
+
+// parseLabels parses labels written as key=value pairs separated by commas.
+func parseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || !task.ValidLabelKey(k) {
+			return nil, fmt.Errorf("invalid label %q, labels are written as key=value", pair)
+		}
+		labels[k] = v
+	}
+	return labels, nil
+}
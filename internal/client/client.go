@@ -0,0 +1,420 @@
+// Package client talks to the manager's HTTP API.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elimt/go-orchestrator/internal/node"
+	"github.com/elimt/go-orchestrator/internal/spec"
+	"github.com/elimt/go-orchestrator/internal/task"
+	"github.com/google/uuid"
+)
+
+type Client struct {
+	// Manager is the base URL of the manager API, e.g. http://localhost:8888.
+	Manager string
+	HTTP    *http.Client
+}
+
+func New(manager string) *Client {
+	if !strings.Contains(manager, "://") {
+		manager = "http://" + manager
+	}
+	return &Client{
+		Manager: strings.TrimSuffix(manager, "/"),
+		HTTP:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// apiError is the ErrResponse body returned by the manager on failure.
+type apiError struct {
+	HTTPStatusCode int
+	Message        string
+	Errors         spec.ValidationErrors
+}
+
+func (c *Client) do(method string, path string, body interface{}) (*http.Response, error) {
+	// Raw bodies are job specs, which may be YAML or JSON.
+	var r io.Reader
+	contentType := "application/json"
+	switch body := body.(type) {
+	case nil:
+	case []byte:
+		r = bytes.NewReader(body)
+		contentType = "application/yaml"
+	default:
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.Manager+path, r)
+	if err != nil {
+		return nil, err
+	}
+	if r != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		e := apiError{}
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Message == "" {
+			return nil, fmt.Errorf("%s %s: %s", method, path, resp.Status)
+		}
+		if len(e.Errors) > 0 {
+			return nil, e.Errors
+		}
+		return nil, errors.New(strings.TrimSpace(e.Message))
+	}
+	return resp, nil
+}
+
+func (c *Client) decode(method string, path string, body interface{}, v interface{}) error {
+	resp, err := c.do(method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Run submits t to be scheduled, assigning it an ID if it has none.
+func (c *Client) Run(t task.Task) (*task.Task, error) {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	t.State = task.Scheduled
+	te := task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Scheduled,
+		Timestamp: time.Now().UTC(),
+		Task:      t,
+	}
+
+	created := task.Task{}
+	err := c.decode(http.MethodPost, "/tasks", te, &created)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// SubmitJob sends a job spec, in YAML or JSON, and returns the job created
+// from it. An invalid spec is reported as spec.ValidationErrors.
+func (c *Client) SubmitJob(data []byte) (*task.Job, error) {
+	j := task.Job{}
+	err := c.decode(http.MethodPost, "/jobs", data, &j)
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// ValidateJob checks a job spec without scheduling it and returns the tasks
+// it would create.
+func (c *Client) ValidateJob(data []byte) ([]*task.Task, error) {
+	var tasks []*task.Task
+	err := c.decode(http.MethodPost, "/jobs/validate", data, &tasks)
+	return tasks, err
+}
+
+func (c *Client) Jobs() ([]*task.Job, error) {
+	var jobs []*task.Job
+	err := c.decode(http.MethodGet, "/jobs", nil, &jobs)
+	return jobs, err
+}
+
+func (c *Client) Job(id uuid.UUID) (*task.Job, error) {
+	j := task.Job{}
+	err := c.decode(http.MethodGet, fmt.Sprintf("/jobs/%s", id), nil, &j)
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// StopJob stops every task of the job.
+func (c *Client) StopJob(id uuid.UUID) (*task.Job, error) {
+	j := task.Job{}
+	err := c.decode(http.MethodDelete, fmt.Sprintf("/jobs/%s", id), nil, &j)
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// ResolveJob finds a job by its full ID, a unique prefix of its ID, or its
+// name. If several jobs share the name, the most recent one is returned.
+func (c *Client) ResolveJob(ref string) (*task.Job, error) {
+	if id, err := uuid.Parse(ref); err == nil {
+		return c.Job(id)
+	}
+
+	jobs, err := c.Jobs()
+	if err != nil {
+		return nil, err
+	}
+	var named *task.Job
+	var matches []*task.Job
+	for _, j := range jobs {
+		if j.Name == ref && (named == nil || j.CreatedAt.After(named.CreatedAt)) {
+			named = j
+		}
+		if strings.HasPrefix(j.ID.String(), ref) {
+			matches = append(matches, j)
+		}
+	}
+	if named != nil {
+		return named, nil
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no job matches %q", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("%q matches %d jobs, use a longer prefix", ref, len(matches))
+	}
+}
+
+// CreateCronJob submits a job spec with a schedule, in YAML or JSON, and
+// returns the created cron job.
+func (c *Client) CreateCronJob(data []byte) (*task.CronJob, error) {
+	cj := task.CronJob{}
+	err := c.decode(http.MethodPost, "/cronjobs", data, &cj)
+	if err != nil {
+		return nil, err
+	}
+	return &cj, nil
+}
+
+func (c *Client) CronJobs() ([]*task.CronJob, error) {
+	var cronJobs []*task.CronJob
+	err := c.decode(http.MethodGet, "/cronjobs", nil, &cronJobs)
+	return cronJobs, err
+}
+
+func (c *Client) CronJob(id uuid.UUID) (*task.CronJob, error) {
+	cj := task.CronJob{}
+	err := c.decode(http.MethodGet, fmt.Sprintf("/cronjobs/%s", id), nil, &cj)
+	if err != nil {
+		return nil, err
+	}
+	return &cj, nil
+}
+
+// RemoveCronJob deletes the cron job. Its runs are left to finish.
+func (c *Client) RemoveCronJob(id uuid.UUID) error {
+	return c.decode(http.MethodDelete, fmt.Sprintf("/cronjobs/%s", id), nil, nil)
+}
+
+// ResolveCronJob finds a cron job by its full ID, a unique prefix of its ID,
+// or its name.
+func (c *Client) ResolveCronJob(ref string) (*task.CronJob, error) {
+	if id, err := uuid.Parse(ref); err == nil {
+		return c.CronJob(id)
+	}
+
+	cronJobs, err := c.CronJobs()
+	if err != nil {
+		return nil, err
+	}
+	var matches []*task.CronJob
+	for _, cj := range cronJobs {
+		if cj.Name == ref {
+			return cj, nil
+		}
+		if strings.HasPrefix(cj.ID.String(), ref) {
+			matches = append(matches, cj)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no cron job matches %q", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("%q matches %d cron jobs, use a longer prefix", ref, len(matches))
+	}
+}
+
+// CreateService submits a service spec, in YAML or JSON, and returns the
+// created service.
+func (c *Client) CreateService(data []byte) (*task.Service, error) {
+	svc := task.Service{}
+	err := c.decode(http.MethodPost, "/services", data, &svc)
+	if err != nil {
+		return nil, err
+	}
+	return &svc, nil
+}
+
+func (c *Client) Services() ([]*task.Service, error) {
+	var services []*task.Service
+	err := c.decode(http.MethodGet, "/services", nil, &services)
+	return services, err
+}
+
+func (c *Client) Service(id uuid.UUID) (*task.Service, error) {
+	svc := task.Service{}
+	err := c.decode(http.MethodGet, fmt.Sprintf("/services/%s", id), nil, &svc)
+	if err != nil {
+		return nil, err
+	}
+	return &svc, nil
+}
+
+// ScaleService sets the number of replicas of the service.
+func (c *Client) ScaleService(id uuid.UUID, replicas int) (*task.Service, error) {
+	svc := task.Service{}
+	body := struct{ Replicas int }{replicas}
+	err := c.decode(http.MethodPost, fmt.Sprintf("/services/%s/scale", id), body, &svc)
+	if err != nil {
+		return nil, err
+	}
+	return &svc, nil
+}
+
+// UpdateService submits a new spec for the service, starting a rolling
+// update if its task changed.
+func (c *Client) UpdateService(id uuid.UUID, data []byte) (*task.Service, error) {
+	svc := task.Service{}
+	err := c.decode(http.MethodPut, fmt.Sprintf("/services/%s", id), data, &svc)
+	if err != nil {
+		return nil, err
+	}
+	return &svc, nil
+}
+
+// RollbackService returns the service to its previous template.
+func (c *Client) RollbackService(id uuid.UUID) (*task.Service, error) {
+	svc := task.Service{}
+	err := c.decode(http.MethodPost, fmt.Sprintf("/services/%s/rollback", id), nil, &svc)
+	if err != nil {
+		return nil, err
+	}
+	return &svc, nil
+}
+
+// RemoveService stops every task of the service and deletes it.
+func (c *Client) RemoveService(id uuid.UUID) error {
+	return c.decode(http.MethodDelete, fmt.Sprintf("/services/%s", id), nil, nil)
+}
+
+// ResolveService finds a service by its full ID, a unique prefix of its ID,
+// or its name.
+func (c *Client) ResolveService(ref string) (*task.Service, error) {
+	if id, err := uuid.Parse(ref); err == nil {
+		return c.Service(id)
+	}
+
+	services, err := c.Services()
+	if err != nil {
+		return nil, err
+	}
+	var matches []*task.Service
+	for _, svc := range services {
+		if svc.Name == ref {
+			return svc, nil
+		}
+		if strings.HasPrefix(svc.ID.String(), ref) {
+			matches = append(matches, svc)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no service matches %q", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("%q matches %d services, use a longer prefix", ref, len(matches))
+	}
+}
+
+func (c *Client) Tasks() ([]*task.Task, error) {
+	var tasks []*task.Task
+	err := c.decode(http.MethodGet, "/tasks", nil, &tasks)
+	return tasks, err
+}
+
+func (c *Client) Task(id uuid.UUID) (*task.Task, error) {
+	t := task.Task{}
+	err := c.decode(http.MethodGet, fmt.Sprintf("/tasks/%s", id), nil, &t)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (c *Client) Stop(id uuid.UUID) error {
+	return c.decode(http.MethodDelete, fmt.Sprintf("/tasks/%s", id), nil, nil)
+}
+
+// Logs returns the output of the task. Callers must close it.
+func (c *Client) Logs(id uuid.UUID) (io.ReadCloser, error) {
+	resp, err := c.do(http.MethodGet, fmt.Sprintf("/tasks/%s/logs", id), nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (c *Client) Nodes() ([]node.Node, error) {
+	var nodes []node.Node
+	err := c.decode(http.MethodGet, "/nodes", nil, &nodes)
+	return nodes, err
+}
+
+// Queue reports each tenant's pending work on the manager.
+func (c *Client) Queue() ([]task.TenantQueue, error) {
+	var tenants []task.TenantQueue
+	err := c.decode(http.MethodGet, "/queue", nil, &tenants)
+	return tenants, err
+}
+
+// ResolveTask finds a task by its full ID, a unique prefix of its ID, or its
+// name.
+func (c *Client) ResolveTask(ref string) (*task.Task, error) {
+	if id, err := uuid.Parse(ref); err == nil {
+		return c.Task(id)
+	}
+
+	tasks, err := c.Tasks()
+	if err != nil {
+		return nil, err
+	}
+	var matches []*task.Task
+	for _, t := range tasks {
+		if t.Name == ref {
+			return t, nil
+		}
+		if strings.HasPrefix(t.ID.String(), ref) {
+			matches = append(matches, t)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no task matches %q", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("%q matches %d tasks, use a longer prefix", ref, len(matches))
+	}
+}
@@ -0,0 +1,227 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elimt/go-orchestrator/internal/cron"
+	"github.com/elimt/go-orchestrator/internal/task"
+	"github.com/google/uuid"
+)
+
+// ErrCronJobExists is returned when a cron job is created with the name of
+// an existing cron job.
+var ErrCronJobExists = errors.New("cron job already exists")
+
+// cronHistory is the number of runs kept in a cron job's JobIDs.
+const cronHistory = 10
+
+// CreateCronJob stores a cron job and works out when it first runs.
+func (m *Manager) CreateCronJob(cj task.CronJob) (*task.CronJob, error) {
+	schedule, err := cron.Parse(cj.Schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	m.cronMu.Lock()
+	defer m.cronMu.Unlock()
+
+	cronJobs, err := m.listCronJobs()
+	if err != nil {
+		return nil, err
+	}
+	for _, existing := range cronJobs {
+		if existing.Name == cj.Name {
+			return nil, fmt.Errorf("%w: %s, remove it first", ErrCronJobExists, cj.Name)
+		}
+	}
+
+	cj.ID = uuid.New()
+	cj.CreatedAt = time.Now().UTC()
+	cj.NextRun = schedule.Next(cj.CreatedAt)
+	err = m.CronJobDB.Put(cj.ID.String(), &cj)
+	if err != nil {
+		return nil, fmt.Errorf("error storing cron job %v: %w", cj.ID, err)
+	}
+	fmt.Printf("Created cron job %v (%s), next run at %v\n", cj.ID, cj.Name, cj.NextRun)
+	return m.GetCronJob(cj.ID)
+}
+
+// RemoveCronJob deletes a cron job. Runs that are still going are left to
+// finish.
+func (m *Manager) RemoveCronJob(id uuid.UUID) error {
+	m.cronMu.Lock()
+	defer m.cronMu.Unlock()
+
+	cj, err := m.getCronJob(id)
+	if err != nil {
+		return err
+	}
+	err = m.CronJobDB.Delete(id.String())
+	if err != nil {
+		return fmt.Errorf("error deleting cron job %v: %w", id, err)
+	}
+	fmt.Printf("Removed cron job %v (%s)\n", cj.ID, cj.Name)
+	return nil
+}
+
+func (m *Manager) getCronJob(id uuid.UUID) (*task.CronJob, error) {
+	result, err := m.CronJobDB.Get(id.String())
+	if err != nil {
+		return nil, err
+	}
+	cj, ok := result.(*task.CronJob)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert %v to task.CronJob", result)
+	}
+	return cj, nil
+}
+
+func (m *Manager) listCronJobs() ([]*task.CronJob, error) {
+	result, err := m.CronJobDB.List()
+	if err != nil {
+		return nil, err
+	}
+	cronJobs, ok := result.([]*task.CronJob)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert %v to a list of cron jobs", result)
+	}
+	sort.Slice(cronJobs, func(i, k int) bool {
+		return cronJobs[i].CreatedAt.Before(cronJobs[k].CreatedAt)
+	})
+	return cronJobs, nil
+}
+
+// GetCronJob returns the cron job with its recent runs.
+func (m *Manager) GetCronJob(id uuid.UUID) (*task.CronJob, error) {
+	cj, err := m.getCronJob(id)
+	if err != nil {
+		return nil, err
+	}
+	cj.Jobs = m.cronRuns(cj)
+	return cj, nil
+}
+
+// GetCronJobs returns every cron job, oldest first, with its recent runs.
+func (m *Manager) GetCronJobs() []*task.CronJob {
+	cronJobs, err := m.listCronJobs()
+	if err != nil {
+		fmt.Printf("Error getting list of cron jobs: %v\n", err)
+		return nil
+	}
+	for _, cj := range cronJobs {
+		cj.Jobs = m.cronRuns(cj)
+	}
+	return cronJobs
+}
+
+// cronRuns looks up the cron job's recent runs, skipping any that can't be
+// found.
+func (m *Manager) cronRuns(cj *task.CronJob) []*task.Job {
+	var jobs []*task.Job
+	for _, id := range cj.JobIDs {
+		j, err := m.GetJob(id)
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs
+}
+
+// RunCronJobs starts the runs of cron jobs as they fall due, checking at the
+// start of every minute.
+func (m *Manager) RunCronJobs() {
+	for {
+		m.runCronJobs(time.Now().UTC())
+		now := time.Now()
+		time.Sleep(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+	}
+}
+
+func (m *Manager) runCronJobs(now time.Time) {
+	m.cronMu.Lock()
+	defer m.cronMu.Unlock()
+
+	cronJobs, err := m.listCronJobs()
+	if err != nil {
+		fmt.Printf("Error getting list of cron jobs: %v\n", err)
+		return
+	}
+	for _, cj := range cronJobs {
+		if cj.NextRun.IsZero() || now.Before(cj.NextRun) {
+			continue
+		}
+
+		m.runCronJob(cj, now)
+
+		// Runs missed while the manager was down are not made up; the job
+		// runs once and then carries on from now.
+		schedule, err := cron.Parse(cj.Schedule)
+		if err != nil {
+			fmt.Printf("Error parsing schedule of cron job %s: %v\n", cj.Name, err)
+			cj.NextRun = time.Time{}
+		} else {
+			cj.NextRun = schedule.Next(now)
+		}
+		err = m.CronJobDB.Put(cj.ID.String(), cj)
+		if err != nil {
+			fmt.Printf("Error storing cron job %v: %v\n", cj.ID, err)
+		}
+	}
+}
+
+// runCronJob submits a run of the cron job, applying its concurrency policy
+// to the runs that are still going.
+func (m *Manager) runCronJob(cj *task.CronJob, now time.Time) {
+	var active []*task.Job
+	for _, j := range m.cronRuns(cj) {
+		if !j.State.Finished() {
+			active = append(active, j)
+		}
+	}
+
+	if len(active) > 0 {
+		switch cj.ConcurrencyPolicy {
+		case task.ConcurrencyForbid:
+			cj.Message = fmt.Sprintf("skipped the run at %s, %s is still %s",
+				now.Format(time.RFC3339), active[0].Name, active[0].State)
+			fmt.Printf("Cron job %s %s\n", cj.Name, cj.Message)
+			return
+		case task.ConcurrencyReplace:
+			for _, j := range active {
+				fmt.Printf("Cron job %s is replacing run %s\n", cj.Name, j.Name)
+				_, err := m.StopJob(j.ID)
+				if err != nil {
+					fmt.Printf("Error stopping job %v: %v\n", j.ID, err)
+				}
+			}
+		}
+	}
+
+	name := fmt.Sprintf("%s-%d", cj.Name, now.Unix())
+	tasks := make([]task.Task, 0, len(cj.Tasks))
+	for _, t := range cj.Tasks {
+		t.ID = uuid.New()
+		t.Name = name + strings.TrimPrefix(t.Name, cj.Name)
+		tasks = append(tasks, t)
+	}
+
+	job, err := m.SubmitJob(name, tasks)
+	if err != nil {
+		cj.Message = fmt.Sprintf("error starting the run at %s: %v", now.Format(time.RFC3339), err)
+		fmt.Printf("Cron job %s: %s\n", cj.Name, cj.Message)
+		return
+	}
+
+	cj.Message = ""
+	cj.LastRun = now
+	cj.JobIDs = append(cj.JobIDs, job.ID)
+	if len(cj.JobIDs) > cronHistory {
+		cj.JobIDs = cj.JobIDs[len(cj.JobIDs)-cronHistory:]
+	}
+	fmt.Printf("Cron job %s started run %s\n", cj.Name, job.Name)
+}
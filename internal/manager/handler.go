@@ -2,10 +2,14 @@ package manager
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"time"
 
+	"github.com/elimt/go-orchestrator/internal/node"
+	"github.com/elimt/go-orchestrator/internal/spec"
+	"github.com/elimt/go-orchestrator/internal/store"
 	"github.com/elimt/go-orchestrator/internal/task"
 	"github.com/go-chi/chi"
 	"github.com/google/uuid"
@@ -21,8 +25,13 @@ type API struct {
 type ErrResponse struct {
 	HTTPStatusCode int
 	Message        string
+	// Errors lists the problems found in an invalid job or service spec.
+	Errors spec.ValidationErrors `json:",omitempty"`
 }
 
+// maxSpecSize bounds the size of a spec accepted by the API.
+const maxSpecSize = 1 << 20
+
 func (a *API) Start() {
 	a.initRouter()
 	err := http.ListenAndServe(fmt.Sprintf("%s:%d", a.Address, a.Port), a.Router)
@@ -38,7 +47,45 @@ func (a *API) initRouter() {
 		r.Post("/", a.StartTaskHandler)
 		r.Get("/", a.GetTasksHandler)
 		r.Route("/{taskID}", func(r chi.Router) {
+			r.Get("/", a.GetTaskHandler)
 			r.Delete("/", a.StopTaskHandler)
+			r.Get("/logs", a.GetTaskLogsHandler)
+		})
+	})
+	a.Router.Route("/jobs", func(r chi.Router) {
+		r.Post("/", a.SubmitJobHandler)
+		r.Get("/", a.GetJobsHandler)
+		r.Post("/validate", a.ValidateJobHandler)
+		r.Route("/{jobID}", func(r chi.Router) {
+			r.Get("/", a.GetJobHandler)
+			r.Delete("/", a.StopJobHandler)
+		})
+	})
+	a.Router.Route("/cronjobs", func(r chi.Router) {
+		r.Post("/", a.CreateCronJobHandler)
+		r.Get("/", a.GetCronJobsHandler)
+		r.Route("/{cronJobID}", func(r chi.Router) {
+			r.Get("/", a.GetCronJobHandler)
+			r.Delete("/", a.RemoveCronJobHandler)
+		})
+	})
+	a.Router.Route("/services", func(r chi.Router) {
+		r.Post("/", a.CreateServiceHandler)
+		r.Get("/", a.GetServicesHandler)
+		r.Route("/{serviceID}", func(r chi.Router) {
+			r.Get("/", a.GetServiceHandler)
+			r.Put("/", a.UpdateServiceHandler)
+			r.Post("/scale", a.ScaleServiceHandler)
+			r.Post("/rollback", a.RollbackServiceHandler)
+			r.Delete("/", a.RemoveServiceHandler)
+		})
+	})
+	a.Router.Get("/queue", a.GetQueueHandler)
+	a.Router.Route("/nodes", func(r chi.Router) {
+		r.Get("/", a.GetNodesHandler)
+		r.Post("/", a.RegisterNodeHandler)
+		r.Route("/{nodeName}", func(r chi.Router) {
+			r.Put("/heartbeat", a.HeartbeatHandler)
 		})
 	})
 }
@@ -64,10 +111,14 @@ func (a *API) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	a.Manager.AddTask(te)
-	fmt.Printf("Added task %v\n", te.Task.ID)
+	t, err := a.Manager.AddTask(te)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	fmt.Printf("Added task %v\n", t.ID)
 	w.WriteHeader(201)
-	err = json.NewEncoder(w).Encode(te.Task)
+	err = json.NewEncoder(w).Encode(t)
 	if err != nil {
 		fmt.Printf("Error encoding error response: %v\n", err)
 	}
@@ -82,32 +133,466 @@ func (a *API) GetTasksHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (a *API) GetTaskHandler(w http.ResponseWriter, r *http.Request) {
+	tID, _ := uuid.Parse(chi.URLParam(r, "taskID"))
+	t, err := a.Manager.GetTask(tID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No task with ID %v found", tID))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(t)
+	if err != nil {
+		fmt.Printf("Error encoding error response: %v\n", err)
+	}
+}
+
+func (a *API) GetTaskLogsHandler(w http.ResponseWriter, r *http.Request) {
+	tID, _ := uuid.Parse(chi.URLParam(r, "taskID"))
+	if _, err := a.Manager.GetTask(tID); err != nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No task with ID %v found", tID))
+		return
+	}
+
+	logs, err := a.Manager.TaskLogs(tID)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	defer logs.Close()
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	_, err = io.Copy(w, logs)
+	if err != nil {
+		fmt.Printf("Error streaming logs for task %v: %v\n", tID, err)
+	}
+}
+
 func (a *API) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
 	taskID := chi.URLParam(r, "taskID")
 	if taskID == "" {
 		fmt.Printf("No taskID passed in request.\n")
 		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
 
 	tID, _ := uuid.Parse(taskID)
-	_, ok := a.Manager.TaskDB[tID]
+	err := a.Manager.StopTask(tID)
+	if errors.Is(err, store.ErrNotFound) {
+		fmt.Printf("No task with ID %v found\n", tID)
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No task with ID %v found", tID))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SubmitJobHandler accepts a job spec in YAML or JSON and creates a job
+// running the tasks it describes.
+func (a *API) SubmitJobHandler(w http.ResponseWriter, r *http.Request) {
+	s, tasks, ok := a.readSpec(w, r)
 	if !ok {
-		fmt.Printf("No task with ID %v found", tID)
-		w.WriteHeader(404)
+		return
+	}
+
+	job, err := a.Manager.SubmitJob(s.Name, tasks)
+	if errors.Is(err, ErrJobExists) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
 	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, job)
+}
+
+func (a *API) GetJobsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.Manager.GetJobs())
+}
+
+func (a *API) GetJobHandler(w http.ResponseWriter, r *http.Request) {
+	jID, _ := uuid.Parse(chi.URLParam(r, "jobID"))
+	job, err := a.Manager.GetJob(jID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No job with ID %v found", jID))
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
 
-	te := task.TaskEvent{
-		ID:        uuid.New(),
-		State:     task.Completed,
-		Timestamp: time.Now(),
+// StopJobHandler stops every task of the job.
+func (a *API) StopJobHandler(w http.ResponseWriter, r *http.Request) {
+	jID, _ := uuid.Parse(chi.URLParam(r, "jobID"))
+	job, err := a.Manager.StopJob(jID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No job with ID %v found", jID))
+		return
 	}
-	taskToStop := a.Manager.TaskDB[tID]
-	// we need to make a copy so we are not modifying the task in the datastore
-	taskCopy := *taskToStop
-	taskCopy.State = task.Completed
-	te.Task = taskCopy
-	a.Manager.AddTask(te)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
 
-	fmt.Printf("Added task event %v to stop task %v\n", te.ID, taskToStop.ID)
+// ValidateJobHandler checks a job spec and returns the tasks it would
+// create, without scheduling them.
+func (a *API) ValidateJobHandler(w http.ResponseWriter, r *http.Request) {
+	_, tasks, ok := a.readSpec(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, tasks)
+}
+
+// readSpec parses and validates the job spec in the request body and
+// builds its tasks. If it is not valid, the error has been written to w.
+func (a *API) readSpec(w http.ResponseWriter, r *http.Request) (*spec.Spec, []task.Task, bool) {
+	data, ok := readSpecBody(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	s, err := spec.Parse(data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, nil, false
+	}
+	tasks, err := s.Build()
+	if err != nil {
+		writeSpecError(w, "invalid job spec", err)
+		return nil, nil, false
+	}
+	return s, tasks, true
+}
+
+// CreateCronJobHandler accepts a job spec with a schedule and creates a cron
+// job that submits it each time the schedule fires.
+func (a *API) CreateCronJobHandler(w http.ResponseWriter, r *http.Request) {
+	data, ok := readSpecBody(w, r)
+	if !ok {
+		return
+	}
+	s, err := spec.Parse(data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	built, err := s.BuildCronJob()
+	if err != nil {
+		writeSpecError(w, "invalid cron job spec", err)
+		return
+	}
+
+	cj, err := a.Manager.CreateCronJob(*built)
+	if errors.Is(err, ErrCronJobExists) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, cj)
+}
+
+func (a *API) GetCronJobsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.Manager.GetCronJobs())
+}
+
+func (a *API) GetCronJobHandler(w http.ResponseWriter, r *http.Request) {
+	cID, _ := uuid.Parse(chi.URLParam(r, "cronJobID"))
+	cj, err := a.Manager.GetCronJob(cID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No cron job with ID %v found", cID))
+		return
+	}
+	writeJSON(w, http.StatusOK, cj)
+}
+
+// RemoveCronJobHandler deletes a cron job, leaving its runs to finish.
+func (a *API) RemoveCronJobHandler(w http.ResponseWriter, r *http.Request) {
+	cID, _ := uuid.Parse(chi.URLParam(r, "cronJobID"))
+	err := a.Manager.RemoveCronJob(cID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No cron job with ID %v found", cID))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// CreateServiceHandler accepts a service spec in YAML or JSON and creates a
+// service running the requested number of replicas.
+func (a *API) CreateServiceHandler(w http.ResponseWriter, r *http.Request) {
+	data, ok := readSpecBody(w, r)
+	if !ok {
+		return
+	}
+	s, err := spec.ParseService(data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	built, err := s.Build()
+	if err != nil {
+		writeSpecError(w, "invalid service spec", err)
+		return
+	}
+
+	svc, err := a.Manager.CreateService(*built)
+	if errors.Is(err, ErrServiceExists) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, svc)
+}
+
+func (a *API) GetServicesHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.Manager.GetServices())
+}
+
+func (a *API) GetServiceHandler(w http.ResponseWriter, r *http.Request) {
+	sID, _ := uuid.Parse(chi.URLParam(r, "serviceID"))
+	svc, err := a.Manager.GetService(sID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No service with ID %v found", sID))
+		return
+	}
+	writeJSON(w, http.StatusOK, svc)
+}
+
+// UpdateServiceHandler accepts a new spec for a service and starts a rolling
+// update if its task changed. The spec must keep the service's name.
+func (a *API) UpdateServiceHandler(w http.ResponseWriter, r *http.Request) {
+	sID, _ := uuid.Parse(chi.URLParam(r, "serviceID"))
+	existing, err := a.Manager.GetService(sID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No service with ID %v found", sID))
+		return
+	}
+
+	data, ok := readSpecBody(w, r)
+	if !ok {
+		return
+	}
+	s, err := spec.ParseService(data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	built, err := s.Build()
+	if err != nil {
+		writeSpecError(w, "invalid service spec", err)
+		return
+	}
+	if built.Name != existing.Name {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Spec is for service %s, not %s", built.Name, existing.Name))
+		return
+	}
+
+	svc, err := a.Manager.UpdateService(sID, *built)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, svc)
+}
+
+// RollbackServiceHandler returns a service to its previous template.
+func (a *API) RollbackServiceHandler(w http.ResponseWriter, r *http.Request) {
+	sID, _ := uuid.Parse(chi.URLParam(r, "serviceID"))
+	svc, err := a.Manager.RollbackService(sID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No service with ID %v found", sID))
+		return
+	}
+	if errors.Is(err, ErrNoPreviousRevision) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, svc)
+}
+
+// ScaleRequest is the body of a request to scale a service.
+type ScaleRequest struct {
+	Replicas int
+}
+
+func (a *API) ScaleServiceHandler(w http.ResponseWriter, r *http.Request) {
+	sID, _ := uuid.Parse(chi.URLParam(r, "serviceID"))
+
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	req := ScaleRequest{}
+	err := d.Decode(&req)
+	if err == nil && req.Replicas < 0 {
+		err = fmt.Errorf("replicas must not be negative")
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Error unmarshalling body: %v", err))
+		return
+	}
+
+	svc, err := a.Manager.ScaleService(sID, req.Replicas)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No service with ID %v found", sID))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, svc)
+}
+
+// RemoveServiceHandler stops every task of the service and deletes it.
+func (a *API) RemoveServiceHandler(w http.ResponseWriter, r *http.Request) {
+	sID, _ := uuid.Parse(chi.URLParam(r, "serviceID"))
+	err := a.Manager.RemoveService(sID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No service with ID %v found", sID))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readSpecBody reads a spec from the request body, writing an error to w if
+// it can't be read or is too large.
+func readSpecBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxSpecSize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Error reading body: %v", err))
+		return nil, false
+	}
+	if len(data) > maxSpecSize {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Spec is larger than %d bytes", maxSpecSize))
+		return nil, false
+	}
+	return data, true
+}
+
+// writeSpecError writes the error returned when building a spec, listing
+// each field error if the spec failed validation.
+func writeSpecError(w http.ResponseWriter, msg string, err error) {
+	var verrs spec.ValidationErrors
+	if !errors.As(err, &verrs) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	e := ErrResponse{
+		HTTPStatusCode: http.StatusUnprocessableEntity,
+		Message:        msg,
+		Errors:         verrs,
+	}
+	writeJSON(w, http.StatusUnprocessableEntity, e)
+}
+
+func (a *API) GetNodesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(w).Encode(a.Manager.GetNodes())
+	if err != nil {
+		fmt.Printf("Error encoding error response: %v\n", err)
+	}
+}
+
+// GetQueueHandler reports each tenant's pending work and wait times.
+func (a *API) GetQueueHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.Manager.TenantQueues())
+}
+
+func (a *API) RegisterNodeHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+
+	n := node.Node{}
+	err := d.Decode(&n)
+	if err == nil && (n.Name == "" || n.API == "") {
+		err = fmt.Errorf("node name and API address are required")
+	}
+	if err != nil {
+		msg := fmt.Sprintf("Error unmarshalling body: %v\n", err)
+		fmt.Printf("error: %v", msg)
+		w.WriteHeader(http.StatusBadRequest)
+		e := ErrResponse{
+			HTTPStatusCode: http.StatusBadRequest,
+			Message:        msg,
+		}
+		err = json.NewEncoder(w).Encode(e)
+		if err != nil {
+			fmt.Printf("Error encoding error response: %v\n", err)
+		}
+		return
+	}
+
+	registered := a.Manager.Register(n)
+	fmt.Printf("Registered worker %v at %v\n", registered.Name, registered.API)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(registered)
+	if err != nil {
+		fmt.Printf("Error encoding error response: %v\n", err)
+	}
+}
+
+func (a *API) HeartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "nodeName")
+	err := a.Manager.Heartbeat(name)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		e := ErrResponse{
+			HTTPStatusCode: http.StatusNotFound,
+			Message:        err.Error(),
+		}
+		err = json.NewEncoder(w).Encode(e)
+		if err != nil {
+			fmt.Printf("Error encoding error response: %v\n", err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	e := ErrResponse{
+		HTTPStatusCode: status,
+		Message:        msg,
+	}
+	err := json.NewEncoder(w).Encode(e)
+	if err != nil {
+		fmt.Printf("Error encoding error response: %v\n", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		fmt.Printf("Error encoding response: %v\n", err)
+	}
+}
@@ -0,0 +1,308 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elimt/go-orchestrator/internal/task"
+	"github.com/google/uuid"
+)
+
+// ErrJobExists is returned when a job is submitted while another job of the
+// same name is still running.
+var ErrJobExists = errors.New("job already exists")
+
+// SubmitJob creates a job from tasks and queues each of them to be
+// scheduled. Tasks with dependencies wait until ResolveDependencies finds
+// them met.
+func (m *Manager) SubmitJob(name string, tasks []task.Task) (*task.Job, error) {
+	m.jobMu.Lock()
+	defer m.jobMu.Unlock()
+
+	for _, j := range m.GetJobs() {
+		if j.Name == name && !j.State.Finished() {
+			return nil, fmt.Errorf("%w: %s is %s, stop it before submitting it again", ErrJobExists, name, j.State)
+		}
+	}
+
+	job := task.Job{
+		ID:        uuid.New(),
+		Name:      name,
+		CreatedAt: time.Now().UTC(),
+	}
+	for i := range tasks {
+		tasks[i].JobID = job.ID
+		job.TaskIDs = append(job.TaskIDs, tasks[i].ID)
+	}
+	err := m.JobDB.Put(job.ID.String(), &job)
+	if err != nil {
+		return nil, fmt.Errorf("error storing job %v: %w", job.ID, err)
+	}
+
+	for _, t := range tasks {
+		if len(t.DependsOn) == 0 {
+			m.submitTask(t)
+			continue
+		}
+		t.State = task.Waiting
+		t.Reason = waitingReason(t.DependsOn)
+		err := m.TaskDB.Put(t.ID.String(), &t)
+		if err != nil {
+			fmt.Printf("Error storing task %v: %v\n", t.ID, err)
+		}
+	}
+	m.signal()
+
+	fmt.Printf("Submitted job %v (%s) with %d tasks\n", job.ID, job.Name, len(tasks))
+	return m.GetJob(job.ID)
+}
+
+// retryTask starts a failed job task again as a new task, if it has retries
+// left, and puts the new task in its place in the job.
+func (m *Manager) retryTask(t *task.Task) {
+	if t.JobID == uuid.Nil || t.Attempt >= t.MaxRetries {
+		return
+	}
+
+	m.jobMu.Lock()
+	defer m.jobMu.Unlock()
+
+	j, err := m.getJob(t.JobID)
+	if err != nil {
+		fmt.Printf("Error getting job %v of task %v: %v\n", t.JobID, t.ID, err)
+		return
+	}
+	i := indexOf(j.TaskIDs, t.ID)
+	if i < 0 {
+		return
+	}
+
+	retry := rerun(t)
+	retry.Attempt++
+
+	j.TaskIDs[i] = retry.ID
+	err = m.JobDB.Put(j.ID.String(), j)
+	if err != nil {
+		fmt.Printf("Error storing job %v: %v\n", j.ID, err)
+		return
+	}
+	m.submitTask(retry)
+	m.signal()
+	fmt.Printf("Task %v of job %s failed with exit code %d, retrying as %v (retry %d of %d)\n",
+		t.ID, j.Name, t.ExitCode, retry.ID, retry.Attempt, retry.MaxRetries)
+}
+
+// ResolveDependencies schedules the waiting tasks of each job whose
+// dependencies are met, and fails those whose dependencies can no longer be
+// met, which in turn fails the tasks that depend on them.
+func (m *Manager) ResolveDependencies() {
+	m.jobMu.Lock()
+	defer m.jobMu.Unlock()
+
+	released := 0
+	for _, j := range m.GetJobs() {
+		if !j.State.Finished() {
+			released += m.resolveJob(j)
+		}
+	}
+	if released > 0 {
+		m.signal()
+	}
+}
+
+// resolveJob settles what it can of the job's waiting tasks and returns the
+// number it queued to be scheduled.
+func (m *Manager) resolveJob(j *task.Job) int {
+	// Dependencies name tasks as they are written in the spec, and the job
+	// prefixes those names with its own. Retries keep the name, so a
+	// dependency follows the latest attempt of its task.
+	byName := make(map[string]*task.Task, len(j.Tasks))
+	for _, t := range j.Tasks {
+		byName[t.Name] = t
+	}
+
+	released := 0
+	for changed := true; changed; {
+		changed = false
+		for _, t := range j.Tasks {
+			if t.State != task.Waiting {
+				continue
+			}
+
+			met, reason := dependenciesMet(j, t, byName)
+			switch {
+			case met:
+				fmt.Printf("Dependencies of task %v (%s) are met, scheduling it\n", t.ID, t.Name)
+				t.Reason = ""
+				m.submitTask(*t)
+				// submitTask stores the task as pending; keep this copy in
+				// step so it isn't looked at again.
+				t.State = task.Pending
+				released++
+			case reason != "":
+				fmt.Printf("Task %v (%s) can't run: %s\n", t.ID, t.Name, reason)
+				t.State = task.Failed
+				t.Reason = reason
+				t.FinishTime = time.Now().UTC()
+				err := m.TaskDB.Put(t.ID.String(), t)
+				if err != nil {
+					fmt.Printf("Error storing task %v: %v\n", t.ID, err)
+				}
+				// Tasks that depend on this one may now fail too.
+				changed = true
+			}
+		}
+	}
+	return released
+}
+
+// dependenciesMet reports whether the dependencies of the job's task t are
+// all met. If one never can be, it also returns why. byName maps the job's
+// task names to its tasks.
+func dependenciesMet(j *task.Job, t *task.Task, byName map[string]*task.Task) (bool, string) {
+	met := true
+	for _, d := range t.DependsOn {
+		dep, ok := byName[fmt.Sprintf("%s-%s", j.Name, d.Task)]
+		if !ok {
+			return false, fmt.Sprintf("dependency %s not found", d.Task)
+		}
+		if d.Met(dep) {
+			continue
+		}
+		met = false
+		if dep.State == task.Failed {
+			return false, fmt.Sprintf("dependency %s failed", d.Task)
+		}
+		if dep.State == task.Completed {
+			return false, finishedReason(d, dep)
+		}
+	}
+	return met, ""
+}
+
+// finishedReason explains why a dependency on dep, which has finished, was
+// not met.
+func finishedReason(d task.Dependency, dep *task.Task) string {
+	switch {
+	case dep.Stopped:
+		return fmt.Sprintf("dependency %s was stopped", d.Task)
+	case dep.ExitCode != 0:
+		return fmt.Sprintf("dependency %s exited with code %d", d.Task, dep.ExitCode)
+	default:
+		return fmt.Sprintf("dependency %s completed without becoming %s", d.Task, d.Condition)
+	}
+}
+
+// rerun returns a copy of t to be started again as a new task, without
+// what it recorded about its earlier run.
+func rerun(t *task.Task) task.Task {
+	r := *t
+	r.ID = uuid.New()
+	r.ContainerID = ""
+	r.Health = ""
+	r.Restarts = nil
+	r.ExitCode = 0
+	r.Stopped = false
+	r.Reason = ""
+	r.StartTime = time.Time{}
+	r.FinishTime = time.Time{}
+	return r
+}
+
+// waitingReason describes what a task with the given dependencies waits
+// for.
+func waitingReason(deps []task.Dependency) string {
+	parts := make([]string, 0, len(deps))
+	for _, d := range deps {
+		parts = append(parts, fmt.Sprintf("%s to be %s", d.Task, d.Condition))
+	}
+	return "waiting for " + strings.Join(parts, ", ")
+}
+
+func indexOf(ids []uuid.UUID, id uuid.UUID) int {
+	for i, v := range ids {
+		if v == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Manager) getJob(id uuid.UUID) (*task.Job, error) {
+	result, err := m.JobDB.Get(id.String())
+	if err != nil {
+		return nil, err
+	}
+	j, ok := result.(*task.Job)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert %v to task.Job", result)
+	}
+	return j, nil
+}
+
+// GetJob returns the job with its tasks and its state derived from them.
+func (m *Manager) GetJob(id uuid.UUID) (*task.Job, error) {
+	j, err := m.getJob(id)
+	if err != nil {
+		return nil, err
+	}
+	m.fillJob(j)
+	return j, nil
+}
+
+// GetJobs returns every job, oldest first, with its tasks and state.
+func (m *Manager) GetJobs() []*task.Job {
+	result, err := m.JobDB.List()
+	if err != nil {
+		fmt.Printf("Error getting list of jobs: %v\n", err)
+		return nil
+	}
+	jobs, ok := result.([]*task.Job)
+	if !ok {
+		fmt.Printf("Error converting %v to a list of jobs\n", result)
+		return nil
+	}
+
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].CreatedAt.Before(jobs[k].CreatedAt)
+	})
+	for _, j := range jobs {
+		m.fillJob(j)
+	}
+	return jobs
+}
+
+// fillJob looks up the job's tasks and derives its state from them. Tasks
+// that can't be found are reported as pending.
+func (m *Manager) fillJob(j *task.Job) {
+	j.Tasks = make([]*task.Task, 0, len(j.TaskIDs))
+	for _, id := range j.TaskIDs {
+		t, err := m.getTask(id)
+		if err != nil {
+			t = &task.Task{ID: id, JobID: j.ID, State: task.Pending}
+		}
+		j.Tasks = append(j.Tasks, t)
+	}
+	j.State = task.JobStateOf(j.Tasks)
+}
+
+// StopJob stops every task of the job that is still running or waiting to
+// run.
+func (m *Manager) StopJob(id uuid.UUID) (*task.Job, error) {
+	j, err := m.getJob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tid := range j.TaskIDs {
+		err := m.StopTask(tid)
+		if err != nil {
+			fmt.Printf("Error stopping task %v of job %v: %v\n", tid, id, err)
+		}
+	}
+	fmt.Printf("Stopping job %v (%s)\n", j.ID, j.Name)
+	return m.GetJob(id)
+}
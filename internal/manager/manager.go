@@ -3,183 +3,826 @@ package manager
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"sync"
 	"time"
 
+	"github.com/elimt/go-orchestrator/internal/node"
+	"github.com/elimt/go-orchestrator/internal/scheduler"
+	"github.com/elimt/go-orchestrator/internal/store"
 	"github.com/elimt/go-orchestrator/internal/task"
 	"github.com/elimt/go-orchestrator/internal/worker"
-	"github.com/golang-collections/collections/queue"
 	"github.com/google/uuid"
 )
 
 type Manager struct {
-	Pending       queue.Queue
-	TaskDB        map[uuid.UUID]*task.Task
-	EventDB       map[uuid.UUID]*task.TaskEvent
+	// Pending holds the task events waiting to be sent to workers, queued
+	// by tenant.
+	Pending       FairQueue
+	TaskDB        store.Store
+	EventDB       store.Store
+	JobDB         store.Store
+	ServiceDB     store.Store
+	CronJobDB     store.Store
 	Workers       []string
 	WorkerTaskMap map[string][]uuid.UUID
 	TaskWorkerMap map[uuid.UUID]string
-	LastWorker    int
+	WorkerNodes   []*node.Node
+	Scheduler     scheduler.Scheduler
+	SuspectAfter  time.Duration
+	DeadAfter     time.Duration
+
+	// ProcessInterval, UpdateInterval and StatsInterval are how often the
+	// manager looks for pending work, polls workers for task updates and
+	// collects node stats. New work is dispatched as soon as it is added;
+	// ProcessInterval only bounds how long unplaceable work waits for a
+	// retry.
+	ProcessInterval time.Duration
+	UpdateInterval  time.Duration
+	StatsInterval   time.Duration
+	// ReconcileInterval is how often services are checked for missing or
+	// surplus replicas.
+	ReconcileInterval time.Duration
+	// BatchSize is the number of pending events dispatched together.
+	BatchSize int
+
+	// mu guards the worker and task maps and the nodes in WorkerNodes.
+	mu        sync.RWMutex
+	pendingMu sync.Mutex
+	wake      chan struct{}
+	// jobMu serialises job submissions so job names stay unique.
+	jobMu sync.Mutex
+	// serviceMu serialises changes to services and their replicas. stopping
+	// holds the service tasks asked to stop that have not finished yet, so
+	// they are not counted as replicas or stopped twice.
+	serviceMu sync.Mutex
+	stopping  map[uuid.UUID]bool
+	// cronMu serialises changes to cron jobs and their runs.
+	cronMu sync.Mutex
 }
 
-func New(workers []string) *Manager {
-	taskDB := make(map[uuid.UUID]*task.Task)
-	eventDB := make(map[uuid.UUID]*task.TaskEvent)
+const (
+	DefaultProcessInterval   = 10 * time.Second
+	DefaultUpdateInterval    = 15 * time.Second
+	DefaultStatsInterval     = 15 * time.Second
+	DefaultReconcileInterval = 10 * time.Second
+	DefaultBatchSize         = 50
+)
+
+// New creates a manager for the given worker addresses, placing tasks with
+// the scheduler registered under schedulerType. Tasks and events are kept in
+// stores of dbType; persistent stores are written to dataDir and any
+// unfinished work found there is queued again.
+func New(workers []string, schedulerType string, dbType string, dataDir string) (*Manager, error) {
+	s, err := scheduler.New(schedulerType)
+	if err != nil {
+		return nil, err
+	}
+
 	workerTaskMap := make(map[string][]uuid.UUID)
 	taskWorkerMap := make(map[uuid.UUID]string)
+	var nodes []*node.Node
 	for worker := range workers {
 		workerTaskMap[workers[worker]] = []uuid.UUID{}
+
+		nAPI := fmt.Sprintf("http://%v", workers[worker])
+		nodes = append(nodes, node.NewNode(workers[worker], nAPI, "worker"))
 	}
 
-	return &Manager{
-		Pending:       *queue.New(),
+	m := &Manager{
 		Workers:       workers,
-		TaskDB:        taskDB,
-		EventDB:       eventDB,
 		WorkerTaskMap: workerTaskMap,
 		TaskWorkerMap: taskWorkerMap,
+		WorkerNodes:   nodes,
+		Scheduler:     s,
+		SuspectAfter:  DefaultSuspectAfter,
+		DeadAfter:     DefaultDeadAfter,
+
+		ProcessInterval: DefaultProcessInterval,
+		UpdateInterval:  DefaultUpdateInterval,
+		StatsInterval:   DefaultStatsInterval,
+		BatchSize:       DefaultBatchSize,
+		wake:            make(chan struct{}, 1),
+
+		ReconcileInterval: DefaultReconcileInterval,
+		stopping:          make(map[uuid.UUID]bool),
+	}
+
+	err = m.openStores(dbType, dataDir)
+	if err != nil {
+		return nil, err
+	}
+	err = m.restore()
+	if err != nil {
+		return nil, fmt.Errorf("unable to restore manager state: %w", err)
 	}
+	return m, nil
 }
 
-func (m *Manager) AddTask(te task.TaskEvent) {
-	m.Pending.Enqueue(te)
+// openStores creates the manager's stores of dbType, in dataDir if they
+// are persistent.
+func (m *Manager) openStores(dbType string, dataDir string) error {
+	var err error
+	m.TaskDB, err = store.NewTaskStore(dbType, dataDir, "manager_tasks.db")
+	if err != nil {
+		return fmt.Errorf("unable to create task store: %w", err)
+	}
+	m.EventDB, err = store.NewEventStore(dbType, dataDir, "manager_events.db")
+	if err != nil {
+		return fmt.Errorf("unable to create task event store: %w", err)
+	}
+	m.JobDB, err = store.NewJobStore(dbType, dataDir, "manager_jobs.db")
+	if err != nil {
+		return fmt.Errorf("unable to create job store: %w", err)
+	}
+	m.ServiceDB, err = store.NewServiceStore(dbType, dataDir, "manager_services.db")
+	if err != nil {
+		return fmt.Errorf("unable to create service store: %w", err)
+	}
+	m.CronJobDB, err = store.NewCronJobStore(dbType, dataDir, "manager_cronjobs.db")
+	if err != nil {
+		return fmt.Errorf("unable to create cron job store: %w", err)
+	}
+	return nil
 }
 
-func (m *Manager) updateTasks() {
-	for _, worker := range m.Workers {
-		fmt.Printf("Checking worker %v for task updates", worker)
-		url := fmt.Sprintf("http://%s/tasks", worker)
-		//nolint:gosec
-		resp, err := http.Get(url)
-		if err != nil {
-			fmt.Printf("Error connecting to %v: %v", worker, err)
+// restore queues the work a previous run of the manager had accepted but
+// not yet handed to a worker: tasks waiting to be rescheduled and events
+// whose task never reached the task store.
+func (m *Manager) restore() error {
+	tasks, err := m.listTasks()
+	if err != nil {
+		return err
+	}
+	events, err := m.listEvents()
+	if err != nil {
+		return err
+	}
+
+	known := make(map[uuid.UUID]*task.Task)
+	for _, t := range tasks {
+		known[t.ID] = t
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Timestamp.After(events[j].Timestamp)
+	})
+	queued := make(map[uuid.UUID]bool)
+	for _, te := range events {
+		t, ok := known[te.Task.ID]
+		if queued[te.Task.ID] || (ok && t.State != task.Pending) {
+			continue
 		}
+		fmt.Printf("Restoring pending task %v\n", te.Task.ID)
+		m.enqueue(*te)
+		queued[te.Task.ID] = true
+	}
+	return nil
+}
+
+func (m *Manager) getTask(id uuid.UUID) (*task.Task, error) {
+	result, err := m.TaskDB.Get(id.String())
+	if err != nil {
+		return nil, err
+	}
+	t, ok := result.(*task.Task)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert %v to task.Task", result)
+	}
+	return t, nil
+}
+
+func (m *Manager) listTasks() ([]*task.Task, error) {
+	result, err := m.TaskDB.List()
+	if err != nil {
+		return nil, err
+	}
+	tasks, ok := result.([]*task.Task)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert %v to a list of tasks", result)
+	}
+	return tasks, nil
+}
+
+func (m *Manager) listEvents() ([]*task.TaskEvent, error) {
+	result, err := m.EventDB.List()
+	if err != nil {
+		return nil, err
+	}
+	events, ok := result.([]*task.TaskEvent)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert %v to a list of task events", result)
+	}
+	return events, nil
+}
 
-		if resp.StatusCode != http.StatusOK {
-			fmt.Printf("Error sending request: %v", err)
+// AddTask queues a task event and wakes the dispatcher, returning the
+// event's task as it was queued. A task started this way is stored as
+// pending with its event, like those of jobs and services, so it can be
+// listed, stopped and restored before it is placed. Its priority is that
+// of its priority class, the default class if it names none, whatever
+// priority the client gave, and a task without a tenant belongs to the
+// default tenant. Events that don't start a task, and tasks of an unknown
+// priority class or preemption policy or with an invalid spread rule, are
+// rejected; tasks are stopped with StopTask.
+func (m *Manager) AddTask(te task.TaskEvent) (task.Task, error) {
+	if te.State != task.Scheduled {
+		return task.Task{}, fmt.Errorf("task events must be in state %d (scheduled), got %d",
+			task.Scheduled, te.State)
+	}
+
+	if te.Task.Tenant == "" {
+		te.Task.Tenant = task.DefaultTenant
+	}
+	err := te.Task.SetPriorityClass(te.Task.PriorityClass)
+	if err != nil {
+		return task.Task{}, err
+	}
+	err = task.ValidatePreemptionPolicy(te.Task.PreemptionPolicy)
+	if err != nil {
+		return task.Task{}, err
+	}
+	for _, r := range te.Task.TopologySpread {
+		err = task.ValidateSpreadRule(r)
+		if err != nil {
+			return task.Task{}, err
 		}
+	}
+	te = m.submitEvent(te)
+	m.signal()
+	return te.Task, nil
+}
+
+// submitTask stores a new task as pending and queues it to be scheduled,
+// so it is listed, and restored after a manager restart, before it is
+// placed. Callers signal the dispatcher once they have queued their work.
+func (m *Manager) submitTask(t task.Task) {
+	m.submitEvent(task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Scheduled,
+		Timestamp: time.Now().UTC(),
+		Task:      t,
+	})
+}
+
+// submitEvent is submitTask for an event that starts a new task. It
+// returns the event as it was queued.
+func (m *Manager) submitEvent(te task.TaskEvent) task.TaskEvent {
+	if te.ID == uuid.Nil {
+		te.ID = uuid.New()
+	}
+	if te.Task.ID == uuid.Nil {
+		te.Task.ID = uuid.New()
+	}
+	if te.Timestamp.IsZero() {
+		te.Timestamp = time.Now().UTC()
+	}
+	te.Task.State = task.Scheduled
+
+	t := te.Task
+	t.State = task.Pending
+	err := m.TaskDB.Put(t.ID.String(), &t)
+	if err != nil {
+		fmt.Printf("Error storing task %v: %v\n", t.ID, err)
+	}
+	err = m.EventDB.Put(te.ID.String(), &te)
+	if err != nil {
+		fmt.Printf("Error storing task event %v: %v\n", te.ID, err)
+	}
+	m.enqueue(te)
+	return te
+}
 
-		d := json.NewDecoder(resp.Body)
-		var tasks []*task.Task
-		err = d.Decode(&tasks)
+func (m *Manager) updateTasks() {
+	for _, n := range m.liveNodes() {
+		m.mu.RLock()
+		worker, api := n.Name, n.API
+		m.mu.RUnlock()
+
+		fmt.Printf("Checking worker %v for task updates\n", worker)
+		tasks, err := m.getWorkerTasks(api)
 		if err != nil {
-			fmt.Printf("Error unmarshalling tasks: %s", err.Error())
+			fmt.Printf("Error getting tasks from %v: %v\n", worker, err)
+			continue
 		}
 
+		var failed, stale []*task.Task
+		finished := false
+		m.mu.Lock()
 		for _, t := range tasks {
-			fmt.Printf("Attempting to update task %v", t.ID)
-
-			_, ok := m.TaskDB[t.ID]
-			if !ok {
-				fmt.Printf("Task with ID %s not found\n", t.ID)
-				return
+			changed, assigned := m.updateTask(n, t)
+			if !assigned && t.Active() {
+				stale = append(stale, t)
 			}
-
-			if m.TaskDB[t.ID].State != t.State {
-				m.TaskDB[t.ID].State = t.State
+			if changed == nil {
+				continue
+			}
+			if changed.State == task.Failed {
+				failed = append(failed, changed)
+			}
+			if !changed.Active() {
+				finished = true
 			}
+		}
+		m.updateAllocation(n)
+		m.mu.Unlock()
 
-			m.TaskDB[t.ID].StartTime = t.StartTime
-			m.TaskDB[t.ID].FinishTime = t.FinishTime
-			m.TaskDB[t.ID].ContainerID = t.ContainerID
+		// Finished tasks free up resources that pending tasks may be
+		// waiting for.
+		if finished {
+			m.signal()
+		}
+		for _, t := range failed {
+			m.retryTask(t)
+		}
+		for _, t := range stale {
+			m.stopStale(n, t)
 		}
 	}
 }
 
+// updateTask records task t as the worker on node n reports it. It returns
+// the stored task if its state changed, or nil, and reports false if the
+// task is no longer assigned to the worker, which ignores the report.
+// Callers must hold m.mu.
+func (m *Manager) updateTask(n *node.Node, t *task.Task) (*task.Task, bool) {
+	fmt.Printf("Attempting to update task %v\n", t.ID)
+
+	persisted, err := m.getTask(t.ID)
+	if err != nil {
+		fmt.Printf("Task with ID %s not found\n", t.ID)
+		return nil, true
+	}
+
+	worker := n.Name
+	assigned, ok := m.TaskWorkerMap[t.ID]
+	if !ok && persisted.State != task.Pending {
+		// The manager was restarted and has lost track of where its
+		// tasks run, so adopt the task onto the worker reporting it.
+		fmt.Printf("Adopting task %v onto worker %v\n", t.ID, worker)
+		m.WorkerTaskMap[worker] = append(m.WorkerTaskMap[worker], t.ID)
+		m.TaskWorkerMap[t.ID] = worker
+		n.TaskCount++
+		assign(n, persisted)
+		assigned = worker
+	}
+
+	// A task moved off a worker that was declared dead may still be
+	// reported by it if the worker comes back.
+	if assigned != worker {
+		fmt.Printf("Ignoring update for task %v from %v, it is no longer assigned there\n", t.ID, worker)
+		return nil, false
+	}
+
+	// A task the manager has already marked finished, such as one that
+	// was preempted, keeps its state while it is stopped.
+	changed := persisted.State != t.State && persisted.Active()
+	if changed {
+		persisted.State = t.State
+	}
+
+	persisted.StartTime = t.StartTime
+	persisted.FinishTime = t.FinishTime
+	persisted.ContainerID = t.ContainerID
+	persisted.Health = t.Health
+	persisted.Restarts = t.Restarts
+	persisted.ExitCode = t.ExitCode
+	err = m.TaskDB.Put(t.ID.String(), persisted)
+	if err != nil {
+		fmt.Printf("Error storing task %v: %v\n", t.ID, err)
+	}
+	if !changed {
+		return nil, true
+	}
+	return persisted, true
+}
+
+// stopStale stops the copy of task t that the worker on node n still runs
+// after the task was moved elsewhere, such as when the worker was declared
+// dead and came back. It is stopped like any other task, with the container
+// the worker reported, and is tried again on the next update if the worker
+// can't be reached.
+func (m *Manager) stopStale(n *node.Node, t *task.Task) {
+	stop := *t
+	stop.State = task.Completed
+	fmt.Printf("Stopping stale copy of task %v in container %v\n", t.ID, t.ContainerID)
+	m.sendTask(task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Completed,
+		Timestamp: time.Now().UTC(),
+		Task:      stop,
+	}, n)
+}
+
+func (m *Manager) getWorkerTasks(api string) ([]*task.Task, error) {
+	url := fmt.Sprintf("%s/tasks", api)
+	//nolint:gosec
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	d := json.NewDecoder(resp.Body)
+	var tasks []*task.Task
+	err = d.Decode(&tasks)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling tasks: %w", err)
+	}
+	return tasks, nil
+}
+
 func (m *Manager) UpdateTasks() {
 	for {
 		fmt.Println("Checking for task updates from workers")
 		m.updateTasks()
-		fmt.Println("Task updates completed")
-		fmt.Println("Sleeping for 15 seconds")
-		time.Sleep(15 * time.Second)
+		m.ResolveDependencies()
+		fmt.Printf("Task updates completed, sleeping for %v\n", m.UpdateInterval)
+		time.Sleep(m.UpdateInterval)
 	}
 }
 
+// ProcessTasks dispatches pending work as soon as AddTask signals that there
+// is some, and every ProcessInterval to retry work that could not be placed.
 func (m *Manager) ProcessTasks() {
 	for {
 		fmt.Println("Processing any tasks in the queue")
 		m.SendWork()
-		fmt.Println("Sleeping for 10 seconds")
-		time.Sleep(10 * time.Second)
+		select {
+		case <-m.wake:
+		case <-time.After(m.ProcessInterval):
+		}
 	}
 }
 
-func (m *Manager) SendWork() {
-	fmt.Println("I will send work to workers")
-	if m.Pending.Len() > 0 {
-		w := m.SelectWorker()
+// signal wakes ProcessTasks if it is waiting for work.
+func (m *Manager) signal() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
 
-		e := m.Pending.Dequeue()
-		te := e.(task.TaskEvent)
-		t := te.Task
-		fmt.Printf("Pulled %v off pending queue", t)
+func (m *Manager) enqueue(te task.TaskEvent) {
+	m.pendingMu.Lock()
+	defer m.pendingMu.Unlock()
+	m.Pending.Enqueue(te)
+}
 
-		m.EventDB[te.ID] = &te
-		m.WorkerTaskMap[w] = append(m.WorkerTaskMap[w], te.Task.ID)
-		m.TaskWorkerMap[t.ID] = w
+// dequeueBatch takes up to n events off the pending queue, in the order
+// FairQueue gives them.
+func (m *Manager) dequeueBatch(n int) []task.TaskEvent {
+	m.pendingMu.Lock()
+	defer m.pendingMu.Unlock()
 
-		t.State = task.Scheduled
-		m.TaskDB[t.ID] = &t
+	var batch []task.TaskEvent
+	for len(batch) < n && m.Pending.Len() > 0 {
+		batch = append(batch, m.Pending.Dequeue())
+	}
+	return batch
+}
 
-		data, err := json.Marshal(te)
-		if err != nil {
-			fmt.Printf("Unable to marshal task object: %v.", t)
-		}
+// PendingCount returns the number of task events waiting to be sent.
+func (m *Manager) PendingCount() int {
+	m.pendingMu.Lock()
+	defer m.pendingMu.Unlock()
+	return m.Pending.Len()
+}
 
-		url := fmt.Sprintf("http://%s/tasks", w)
-		//nolint:gosec
-		resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
-		if err != nil {
-			fmt.Printf("Error connecting to %v: %v", w, err)
-			m.Pending.Enqueue(t)
-			return
+// TenantQueues reports how much work each tenant has queued and how long
+// its tasks wait to be dispatched.
+func (m *Manager) TenantQueues() []task.TenantQueue {
+	m.pendingMu.Lock()
+	defer m.pendingMu.Unlock()
+	return m.Pending.Tenants(time.Now().UTC())
+}
+
+// dispatched records how long the task of te waited before it was sent to
+// a worker.
+func (m *Manager) dispatched(te task.TaskEvent) {
+	m.pendingMu.Lock()
+	defer m.pendingMu.Unlock()
+	m.Pending.Dispatched(te, time.Now().UTC())
+}
+
+// SendWork drains the pending queue in batches of BatchSize, taking work
+// from each tenant in proportion to its weight. Each batch is placed one
+// event at a time, so the scheduler sees every earlier placement,
+// and then sent to the workers in parallel. A task that cannot be placed
+// may preempt tasks of a lower priority to make room. Events that still
+// cannot be placed, or cannot be delivered, are queued again for the next
+// round.
+func (m *Manager) SendWork() {
+	batchSize := m.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	var retry []task.TaskEvent
+	for {
+		batch := m.dequeueBatch(batchSize)
+		if len(batch) == 0 {
+			break
 		}
+		fmt.Printf("Pulled %d task events off pending queue\n", len(batch))
 
-		d := json.NewDecoder(resp.Body)
-		if resp.StatusCode != http.StatusCreated {
-			e := worker.ErrResponse{}
-			err := d.Decode(&e)
+		var wg sync.WaitGroup
+		var retryMu sync.Mutex
+		for _, te := range batch {
+			n, err := m.placeTask(te)
+			if err != nil && !errors.Is(err, errTaskFinished) && te.State != task.Completed && m.preempt(te.Task) {
+				n, err = m.placeTask(te)
+			}
+			if errors.Is(err, errTaskFinished) {
+				fmt.Printf("Not starting task %v, it was stopped before it was placed\n", te.Task.ID)
+				continue
+			}
 			if err != nil {
-				fmt.Printf("Error decoding response: %s\n", err.Error())
-				return
+				fmt.Printf("Error selecting worker for task %v: %v\n", te.Task.ID, err)
+				retry = append(retry, te)
+				continue
 			}
-			fmt.Printf("Response error (%d): %s", e.HTTPStatusCode, e.Message)
-			return
+			wg.Add(1)
+			go func(te task.TaskEvent, n *node.Node) {
+				defer wg.Done()
+				if !m.sendTask(te, n) {
+					retryMu.Lock()
+					retry = append(retry, te)
+					retryMu.Unlock()
+				}
+			}(te, n)
 		}
+		wg.Wait()
+	}
+
+	if len(retry) == 0 {
+		fmt.Println("No work in the queue")
+	}
+	for _, te := range retry {
+		m.enqueue(te)
+	}
+}
+
+// errTaskFinished is returned by placeTask for a task that was stopped or
+// failed while its start was queued.
+var errTaskFinished = errors.New("task has already finished")
+
+// placeTask selects a worker for the event's task and records the
+// assignment.
+func (m *Manager) placeTask(te task.TaskEvent) (*node.Node, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := te.Task
+	if t.State != task.Completed {
+		persisted, err := m.getTask(t.ID)
+		if err == nil && (persisted.State == task.Completed || persisted.State == task.Failed) {
+			return nil, errTaskFinished
+		}
+	}
+
+	n, err := m.selectWorker(t)
+	if err != nil {
+		if t.State != task.Completed {
+			m.setPendingReason(t.ID, err.Error())
+		}
+		return nil, err
+	}
+
+	err = m.EventDB.Put(te.ID.String(), &te)
+	if err != nil {
+		fmt.Printf("Error storing task event %v: %v\n", te.ID, err)
+	}
+	if _, ok := m.TaskWorkerMap[t.ID]; !ok {
+		m.WorkerTaskMap[n.Name] = append(m.WorkerTaskMap[n.Name], t.ID)
+		m.TaskWorkerMap[t.ID] = n.Name
+		n.TaskCount++
+		assign(n, &t)
+	}
+
+	if t.State != task.Completed {
+		t.State = task.Scheduled
+		t.Reason = ""
+		err = m.TaskDB.Put(t.ID.String(), &t)
+		if err != nil {
+			fmt.Printf("Error storing task %v: %v\n", t.ID, err)
+		}
+	}
+	return n, nil
+}
+
+// sendTask delivers the event to the worker on node n. It reports false if
+// the worker could not be reached and the event should be retried.
+func (m *Manager) sendTask(te task.TaskEvent, n *node.Node) bool {
+	m.mu.RLock()
+	w, api := n.Name, n.API
+	m.mu.RUnlock()
 
-		t = task.Task{}
-		err = d.Decode(&t)
+	data, err := json.Marshal(te)
+	if err != nil {
+		fmt.Printf("Unable to marshal task object: %v.\n", te.Task)
+		return true
+	}
+
+	url := fmt.Sprintf("%s/tasks", api)
+	//nolint:gosec
+	resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		fmt.Printf("Error connecting to %v: %v\n", w, err)
+		return false
+	}
+	defer resp.Body.Close()
+
+	d := json.NewDecoder(resp.Body)
+	if resp.StatusCode != http.StatusCreated {
+		e := worker.ErrResponse{}
+		err := d.Decode(&e)
 		if err != nil {
 			fmt.Printf("Error decoding response: %s\n", err.Error())
-			return
+			return true
 		}
-		fmt.Printf("%#v\n", t)
-	} else {
-		fmt.Println("No work in the queue")
+		fmt.Printf("Response error (%d): %s\n", e.HTTPStatusCode, e.Message)
+		return true
+	}
+
+	t := task.Task{}
+	err = d.Decode(&t)
+	if err != nil {
+		fmt.Printf("Error decoding response: %s\n", err.Error())
+		return true
+	}
+	fmt.Printf("Sent task %v to worker %v\n", t.ID, w)
+	if te.State != task.Completed {
+		m.dispatched(te)
 	}
+	return true
 }
 
-// SelectWorker using a round robin algorithm
-func (m *Manager) SelectWorker() string {
-	fmt.Println("I will send work to workers")
-	var newWorker int
-	if m.LastWorker+1 < len(m.Workers) {
-		newWorker = m.LastWorker + 1
-		m.LastWorker++
-	} else {
-		newWorker = 0
-		m.LastWorker = 0
+// StopTask stops a task. A task that has not been handed to a worker yet is
+// marked completed so it is never started.
+func (m *Manager) StopTask(id uuid.UUID) error {
+	m.mu.Lock()
+	t, err := m.getTask(id)
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	switch t.State {
+	case task.Completed, task.Failed:
+		m.mu.Unlock()
+		return nil
+	case task.Pending:
+		if _, placed := m.TaskWorkerMap[id]; !placed {
+			t.State = task.Completed
+			t.Stopped = true
+			t.FinishTime = time.Now().UTC()
+			err = m.TaskDB.Put(id.String(), t)
+			m.mu.Unlock()
+			return err
+		}
+	case task.Waiting:
+		t.State = task.Completed
+		t.Stopped = true
+		t.FinishTime = time.Now().UTC()
+		err = m.TaskDB.Put(id.String(), t)
+		m.mu.Unlock()
+		return err
+	}
+	// Remember the task was stopped, so that it finishing doesn't count
+	// as completing.
+	t.Stopped = true
+	err = m.TaskDB.Put(id.String(), t)
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// we need to make a copy so we are not modifying the task in the datastore
+	taskCopy := *t
+	taskCopy.State = task.Completed
+	te := task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Completed,
+		Timestamp: time.Now().UTC(),
+		Task:      taskCopy,
+	}
+	m.enqueue(te)
+	m.signal()
+	fmt.Printf("Added task event %v to stop task %v\n", te.ID, t.ID)
+	return nil
+}
+
+// SelectWorker picks the node a task should run on. Tasks that have already
+// been placed stay on their worker; everything else goes through the
+// scheduler.
+func (m *Manager) SelectWorker(t task.Task) (*node.Node, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.selectWorker(t)
+}
+
+// selectWorker is SelectWorker for callers that already hold m.mu.
+func (m *Manager) selectWorker(t task.Task) (*node.Node, error) {
+	if w, ok := m.TaskWorkerMap[t.ID]; ok {
+		if placed := m.getNode(w); placed != nil {
+			return placed, nil
+		}
+	}
+
+	nodes := m.healthyNodes()
+	candidates := m.Scheduler.SelectCandidateNodes(t, nodes)
+	if len(candidates) == 0 {
+		return nil, unplaceable(t, nodes)
+	}
+
+	scores := m.Scheduler.Score(t, candidates)
+	selectedNode := m.Scheduler.Pick(scores, candidates)
+	if selectedNode == nil {
+		return nil, fmt.Errorf("scheduler did not pick a node for task %v", t.ID)
 	}
 
-	return m.Workers[newWorker]
+	return selectedNode, nil
+}
+
+func (m *Manager) updateNodeStats() {
+	for _, n := range m.liveNodes() {
+		m.mu.RLock()
+		probe := node.Node{Name: n.Name, API: n.API}
+		m.mu.RUnlock()
+
+		fmt.Printf("Collecting stats for node %v\n", probe.Name)
+		_, err := probe.GetStats()
+		if err != nil {
+			fmt.Printf("Error updating node stats: %v\n", err)
+			continue
+		}
+
+		m.mu.Lock()
+		n.Stats = probe.Stats
+		n.Memory = probe.Memory
+		n.Disk = probe.Disk
+		m.mu.Unlock()
+	}
+}
+
+func (m *Manager) UpdateNodeStats() {
+	for {
+		m.updateNodeStats()
+		fmt.Printf("Node stats update completed, sleeping for %v\n", m.StatsInterval)
+		time.Sleep(m.StatsInterval)
+	}
 }
 
 func (m *Manager) GetTasks() []*task.Task {
-	tasks := make([]*task.Task, len(m.TaskWorkerMap))
-	for t := range m.TaskWorkerMap {
-		tasks = append(tasks, m.TaskDB[t])
+	tasks, err := m.listTasks()
+	if err != nil {
+		fmt.Printf("Error getting list of tasks: %v\n", err)
+		return nil
 	}
 	return tasks
 }
+
+// GetTask returns the task with the given ID.
+func (m *Manager) GetTask(id uuid.UUID) (*task.Task, error) {
+	return m.getTask(id)
+}
+
+// TaskLogs fetches the output of a task from the worker it was placed on.
+func (m *Manager) TaskLogs(id uuid.UUID) (io.ReadCloser, error) {
+	m.mu.RLock()
+	var api string
+	if w, ok := m.TaskWorkerMap[id]; ok {
+		if n := m.getNode(w); n != nil {
+			api = n.API
+		}
+	}
+	m.mu.RUnlock()
+	if api == "" {
+		return nil, fmt.Errorf("task %v is not running on any worker", id)
+	}
+
+	url := fmt.Sprintf("%s/tasks/%s/logs", api, id)
+	//nolint:gosec
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		e := worker.ErrResponse{}
+		err := json.NewDecoder(resp.Body).Decode(&e)
+		if err != nil || e.Message == "" {
+			return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return nil, errors.New(e.Message)
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,229 @@
+package manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/elimt/go-orchestrator/internal/store"
+	"github.com/elimt/go-orchestrator/internal/task"
+	"github.com/elimt/go-orchestrator/internal/worker"
+	"github.com/google/uuid"
+)
+
+// newTestManager returns a manager with in-memory stores for the given
+// workers.
+func newTestManager(t *testing.T, workers ...string) *Manager {
+	t.Helper()
+	m, err := New(workers, "", store.MemoryType, "")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return m
+}
+
+// newTestWorker starts a worker on the fake runtime, with its task and
+// update loops running, behind a test server that serves the task routes
+// the manager uses, and returns the worker and the server's address.
+func newTestWorker(t *testing.T, name string, rt *task.Fake) (*worker.Worker, string) {
+	t.Helper()
+	w, err := worker.New(name, rt, store.MemoryType, "")
+	if err != nil {
+		t.Fatalf("worker.New: %v", err)
+	}
+	api := &worker.API{Worker: w}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tasks", func(rw http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			api.StartTaskHandler(rw, r)
+		case http.MethodGet:
+			api.GetTasksHandler(rw, r)
+		default:
+			rw.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	w.UpdateInterval = 20 * time.Millisecond
+	go w.RunTasks()
+	go w.UpdateTasks()
+	return w, srv.Listener.Addr().String()
+}
+
+// waitForWorkerState waits for the worker to record task id in state.
+func waitForWorkerState(t *testing.T, w *worker.Worker, id uuid.UUID, state task.State) *task.Task {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, wt := range w.GetTasks() {
+			if wt.ID == id && wt.State == state {
+				return wt
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("worker did not record task %v as %v", id, state)
+	return nil
+}
+
+// waitForStoredState waits for the manager to record task id in state.
+func waitForStoredState(t *testing.T, m *Manager, id uuid.UUID, state task.State) *task.Task {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		stored, err := m.getTask(id)
+		if err == nil && stored.State == state {
+			return stored
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("manager did not record task %v as %v", id, state)
+	return nil
+}
+
+// storedTask returns the manager's record of task id.
+func storedTask(t *testing.T, m *Manager, id uuid.UUID) *task.Task {
+	t.Helper()
+	stored, err := m.getTask(id)
+	if err != nil {
+		t.Fatalf("getting task %v: %v", id, err)
+	}
+	return stored
+}
+
+func TestTaskLifecycle(t *testing.T) {
+	rt := task.NewFake()
+	w, addr := newTestWorker(t, "w1", rt)
+	m := newTestManager(t, addr)
+
+	submitted, err := m.AddTask(task.TaskEvent{
+		State: task.Scheduled,
+		Task:  task.Task{Name: "hello", Image: "alpine", CPU: 0.5},
+	})
+	if err != nil {
+		t.Fatalf("AddTask: %v", err)
+	}
+	if got := storedTask(t, m, submitted.ID).State; got != task.Pending {
+		t.Fatalf("submitted task is %v, want pending", got)
+	}
+
+	// Placing the task assigns it to the only worker and sends it there.
+	m.SendWork()
+	if got := storedTask(t, m, submitted.ID).State; got != task.Scheduled {
+		t.Fatalf("placed task is %v, want scheduled", got)
+	}
+	if got := m.TaskWorkerMap[submitted.ID]; got != addr {
+		t.Fatalf("task placed on %q, want %q", got, addr)
+	}
+	if got := m.WorkerNodes[0].CPUAllocated; got != 0.5 {
+		t.Errorf("worker has %v cores allocated, want 0.5", got)
+	}
+
+	// From here on the worker's and the manager's update loops report the
+	// task's progress, as they do in production.
+	m.UpdateInterval = 20 * time.Millisecond
+	go m.UpdateTasks()
+
+	running := waitForWorkerState(t, w, submitted.ID, task.Running)
+	if got := waitForStoredState(t, m, submitted.ID, task.Running); got.ContainerID != running.ContainerID {
+		t.Fatalf("task is running in container %q, want %q", got.ContainerID, running.ContainerID)
+	}
+
+	// The container exits cleanly, the worker notices and the manager
+	// records the task as completed and frees its resources.
+	err = rt.Exit(running.ContainerID, 0)
+	if err != nil {
+		t.Fatalf("Exit: %v", err)
+	}
+	waitForWorkerState(t, w, submitted.ID, task.Completed)
+	if got := waitForStoredState(t, m, submitted.ID, task.Completed); got.ExitCode != 0 {
+		t.Errorf("task completed with exit code %d, want 0", got.ExitCode)
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if got := m.WorkerNodes[0].CPUAllocated; got != 0 {
+		t.Errorf("worker has %v cores allocated after the task completed, want 0", got)
+	}
+}
+
+func TestAddTask(t *testing.T) {
+	tests := []struct {
+		name         string
+		state        task.State
+		task         task.Task
+		wantErr      bool
+		wantPriority int
+	}{
+		{
+			name:         "default class",
+			state:        task.Scheduled,
+			task:         task.Task{Name: "t", Priority: 1000000},
+			wantPriority: 500,
+		},
+		{
+			name:         "named class",
+			state:        task.Scheduled,
+			task:         task.Task{Name: "t", PriorityClass: task.PriorityHigh},
+			wantPriority: 1000,
+		},
+		{
+			name:    "unknown class",
+			state:   task.Scheduled,
+			task:    task.Task{Name: "t", PriorityClass: "urgent"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown preemption policy",
+			state:   task.Scheduled,
+			task:    task.Task{Name: "t", PreemptionPolicy: "always"},
+			wantErr: true,
+		},
+		{
+			name:  "spread without skew",
+			state: task.Scheduled,
+			task: task.Task{Name: "t", TopologySpread: []task.SpreadRule{
+				{Key: "zone", Selector: task.Constraint{Key: "app", Operator: task.ConstraintExists}},
+			}},
+			wantErr: true,
+		},
+		{
+			name:    "no state",
+			task:    task.Task{Name: "t", Priority: 1000000},
+			wantErr: true,
+		},
+		{
+			name:    "stop",
+			state:   task.Completed,
+			task:    task.Task{ID: uuid.New(), Name: "t"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			got, err := m.AddTask(task.TaskEvent{State: tt.state, Task: tt.task})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("AddTask succeeded, want an error")
+				}
+				if n := m.PendingCount(); n != 0 {
+					t.Errorf("%d events queued, want none", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AddTask: %v", err)
+			}
+			stored := storedTask(t, m, got.ID)
+			if stored.State != task.Pending || stored.Priority != tt.wantPriority ||
+				stored.Tenant != task.DefaultTenant {
+				t.Errorf("stored task is %v with priority %d for tenant %q, want pending with %d for %q",
+					stored.State, stored.Priority, stored.Tenant, tt.wantPriority, task.DefaultTenant)
+			}
+		})
+	}
+}
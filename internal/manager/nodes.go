@@ -0,0 +1,274 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elimt/go-orchestrator/internal/node"
+	"github.com/elimt/go-orchestrator/internal/scheduler"
+	"github.com/elimt/go-orchestrator/internal/task"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultSuspectAfter is how long a worker may go without a heartbeat
+	// before it is marked suspect.
+	DefaultSuspectAfter = 30 * time.Second
+	// DefaultDeadAfter is how long a worker may go without a heartbeat
+	// before it is marked dead and no longer receives work.
+	DefaultDeadAfter = 60 * time.Second
+)
+
+// Register adds a worker to the cluster, or refreshes it if a worker with the
+// same name has registered before.
+func (m *Manager) Register(n node.Node) node.Node {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n.Status = node.Healthy
+	n.LastHeartbeat = time.Now().UTC()
+
+	existing := m.getNode(n.Name)
+	if existing != nil {
+		existing.API = n.API
+		existing.IP = n.IP
+		existing.Memory = n.Memory
+		existing.Disk = n.Disk
+		existing.Cores = n.Cores
+		existing.Role = n.Role
+		existing.Labels = n.Labels
+		existing.Status = n.Status
+		existing.LastHeartbeat = n.LastHeartbeat
+		return *existing
+	}
+
+	// Allocations are the manager's to count, from the tasks it places.
+	n.MemoryAllocated, n.DiskAllocated, n.CPUAllocated = 0, 0, 0
+	m.WorkerNodes = append(m.WorkerNodes, &n)
+	m.Workers = append(m.Workers, n.Name)
+	if _, ok := m.WorkerTaskMap[n.Name]; !ok {
+		m.WorkerTaskMap[n.Name] = []uuid.UUID{}
+	}
+	// Work that had nowhere to go may fit on the new worker.
+	m.signal()
+	return n
+}
+
+// Heartbeat records that the named worker is alive.
+func (m *Manager) Heartbeat(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.getNode(name)
+	if n == nil {
+		return fmt.Errorf("no worker named %s is registered", name)
+	}
+	if n.Status != node.Healthy {
+		fmt.Printf("Worker %s is healthy again\n", name)
+	}
+	n.Status = node.Healthy
+	n.LastHeartbeat = time.Now().UTC()
+	return nil
+}
+
+// GetNodes returns a snapshot of the cluster membership.
+func (m *Manager) GetNodes() []node.Node {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	nodes := make([]node.Node, 0, len(m.WorkerNodes))
+	for _, n := range m.WorkerNodes {
+		nodes = append(nodes, *n)
+	}
+	return nodes
+}
+
+// CheckWorkers periodically marks workers that have stopped sending
+// heartbeats as suspect and then dead.
+func (m *Manager) CheckWorkers() {
+	for {
+		m.checkWorkers()
+		time.Sleep(m.SuspectAfter / 2)
+	}
+}
+
+func (m *Manager) checkWorkers() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, n := range m.WorkerNodes {
+		silence := now.Sub(n.LastHeartbeat)
+
+		status := node.Healthy
+		switch {
+		case silence >= m.DeadAfter:
+			status = node.Dead
+		case silence >= m.SuspectAfter:
+			status = node.Suspect
+		}
+
+		if status != n.Status {
+			fmt.Printf("Worker %s is %s, last heartbeat %v ago\n", n.Name, status, silence.Round(time.Second))
+			n.Status = status
+			if status == node.Dead {
+				m.rescheduleTasks(n)
+			}
+		}
+	}
+}
+
+// rescheduleTasks moves the unfinished tasks of a dead worker back onto the
+// pending queue so the scheduler can place them elsewhere. Callers must hold
+// m.mu.
+func (m *Manager) rescheduleTasks(n *node.Node) {
+	var remaining []uuid.UUID
+	for _, id := range m.WorkerTaskMap[n.Name] {
+		t, err := m.getTask(id)
+		if err != nil || t.State == task.Completed || t.State == task.Failed {
+			remaining = append(remaining, id)
+			continue
+		}
+
+		delete(m.TaskWorkerMap, id)
+		if n.TaskCount > 0 {
+			n.TaskCount--
+		}
+
+		taskCopy := *t
+		taskCopy.State = task.Scheduled
+		taskCopy.ContainerID = ""
+		taskCopy.StartTime = time.Time{}
+		taskCopy.FinishTime = time.Time{}
+
+		te := task.TaskEvent{
+			ID:        uuid.New(),
+			State:     task.Scheduled,
+			Timestamp: time.Now().UTC(),
+			Task:      taskCopy,
+			Reason:    fmt.Sprintf("worker %s is dead", n.Name),
+		}
+
+		// Persist the task as pending so a restarted manager queues it again.
+		t.State = task.Pending
+		err = m.TaskDB.Put(id.String(), t)
+		if err != nil {
+			fmt.Printf("Error storing task %v: %v\n", id, err)
+		}
+		err = m.EventDB.Put(te.ID.String(), &te)
+		if err != nil {
+			fmt.Printf("Error storing task event %v: %v\n", te.ID, err)
+		}
+		m.enqueue(te)
+		fmt.Printf("Rescheduling task %v from dead worker %v\n", id, n.Name)
+	}
+	m.WorkerTaskMap[n.Name] = remaining
+	m.updateAllocation(n)
+	m.signal()
+}
+
+// updateAllocation recounts the resources allocated on n, and the labels
+// of the tasks it runs, from the tasks placed there that have not finished,
+// correcting for tasks that finished or moved since they were placed.
+// Callers must hold m.mu.
+func (m *Manager) updateAllocation(n *node.Node) {
+	n.MemoryAllocated, n.DiskAllocated, n.CPUAllocated = 0, 0, 0
+	n.TaskLabels = nil
+	for _, id := range m.WorkerTaskMap[n.Name] {
+		t, err := m.getTask(id)
+		if err != nil || !t.Active() {
+			continue
+		}
+		assign(n, t)
+	}
+}
+
+// assign counts task t against n's resources and records its labels there.
+// Callers must hold m.mu.
+func assign(n *node.Node, t *task.Task) {
+	n.Allocate(t.Memory, t.Disk, t.CPU)
+	if len(t.Labels) > 0 {
+		n.TaskLabels = append(n.TaskLabels, t.Labels)
+	}
+}
+
+// unplaceable explains why none of nodes can take task t, counting the
+// nodes turned down for each reason, for example "no worker can run the
+// task: 2 insufficient memory, 1 didn't match node.role == worker".
+func unplaceable(t task.Task, nodes []*node.Node) error {
+	if len(nodes) == 0 {
+		return errors.New("no healthy workers")
+	}
+
+	counts := make(map[string]int)
+	var reasons []string
+	for _, reason := range scheduler.Reasons(t, nodes) {
+		if reason == "" {
+			continue
+		}
+		if counts[reason] == 0 {
+			reasons = append(reasons, reason)
+		}
+		counts[reason]++
+	}
+	if len(reasons) == 0 {
+		return errors.New("no worker can run the task")
+	}
+	parts := make([]string, 0, len(reasons))
+	for _, r := range reasons {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[r], r))
+	}
+	return fmt.Errorf("no worker can run the task: %s", strings.Join(parts, ", "))
+}
+
+// setPendingReason records on a task that is still pending why it has not
+// been placed. Callers must hold m.mu.
+func (m *Manager) setPendingReason(id uuid.UUID, reason string) {
+	t, err := m.getTask(id)
+	if err != nil || t.State != task.Pending || t.Reason == reason {
+		return
+	}
+	t.Reason = reason
+	err = m.TaskDB.Put(id.String(), t)
+	if err != nil {
+		fmt.Printf("Error storing task %v: %v\n", id, err)
+	}
+}
+
+// healthyNodes returns the workers that may be given new work. Callers must
+// hold m.mu.
+func (m *Manager) healthyNodes() []*node.Node {
+	var nodes []*node.Node
+	for _, n := range m.WorkerNodes {
+		if n.Status == node.Healthy {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// liveNodes returns the workers that have not been declared dead.
+func (m *Manager) liveNodes() []*node.Node {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var nodes []*node.Node
+	for _, n := range m.WorkerNodes {
+		if n.Status != node.Dead {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// getNode looks up a worker by name. Callers must hold m.mu.
+func (m *Manager) getNode(name string) *node.Node {
+	for _, n := range m.WorkerNodes {
+		if n.Name == name {
+			return n
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package manager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/elimt/go-orchestrator/internal/node"
+	"github.com/elimt/go-orchestrator/internal/task"
+	"github.com/elimt/go-orchestrator/internal/worker"
+)
+
+func TestDeadWorkerReturns(t *testing.T) {
+	runtimes := map[string]*task.Fake{}
+	workers := map[string]*worker.Worker{}
+	var addrs []string
+	for _, name := range []string{"w1", "w2"} {
+		rt := task.NewFake()
+		w, addr := newTestWorker(t, name, rt)
+		runtimes[addr], workers[addr] = rt, w
+		addrs = append(addrs, addr)
+	}
+	m := newTestManager(t, addrs...)
+
+	submitted, err := m.AddTask(task.TaskEvent{State: task.Scheduled, Task: task.Task{Name: "web", Image: "nginx"}})
+	if err != nil {
+		t.Fatalf("AddTask: %v", err)
+	}
+	m.SendWork()
+	first := m.getNode(m.TaskWorkerMap[submitted.ID])
+	stale := waitForWorkerState(t, workers[first.Name], submitted.ID, task.Running)
+	m.updateTasks()
+
+	// The worker running the task goes silent and is declared dead, so the
+	// task is placed on the other worker.
+	first.LastHeartbeat = time.Now().UTC().Add(-2 * m.DeadAfter)
+	m.checkWorkers()
+	if first.Status != node.Dead {
+		t.Fatalf("silent worker is %s, want dead", first.Status)
+	}
+	if got := storedTask(t, m, submitted.ID).State; got != task.Pending {
+		t.Fatalf("task on the dead worker is %v, want pending", got)
+	}
+	m.SendWork()
+	second := m.getNode(m.TaskWorkerMap[submitted.ID])
+	if second == nil || second == first {
+		t.Fatalf("task rescheduled onto %v, want the other worker", second)
+	}
+	moved := waitForWorkerState(t, workers[second.Name], submitted.ID, task.Running)
+	m.updateTasks()
+
+	// The dead worker comes back still running its copy, which is stopped,
+	// while the copy on the other worker keeps running.
+	err = m.Heartbeat(first.Name)
+	if err != nil {
+		t.Fatalf("Heartbeat: %v", err)
+	}
+	m.updateTasks()
+	waitForWorkerState(t, workers[first.Name], submitted.ID, task.Completed)
+	if _, err := runtimes[first.Name].Inspect(context.Background(), stale.ContainerID); err == nil {
+		t.Errorf("stale container %v still exists", stale.ContainerID)
+	}
+
+	m.updateTasks()
+	got := storedTask(t, m, submitted.ID)
+	if got.State != task.Running || got.ContainerID != moved.ContainerID {
+		t.Errorf("task is %v in container %q, want running in %q", got.State, got.ContainerID, moved.ContainerID)
+	}
+	if m.TaskWorkerMap[submitted.ID] != second.Name {
+		t.Errorf("task is assigned to %q, want %q", m.TaskWorkerMap[submitted.ID], second.Name)
+	}
+	for _, wt := range workers[second.Name].GetTasks() {
+		if wt.ID == submitted.ID && wt.State != task.Running {
+			t.Errorf("rescheduled copy is %v, want running", wt.State)
+		}
+	}
+}
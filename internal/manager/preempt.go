@@ -0,0 +1,151 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/elimt/go-orchestrator/internal/node"
+	"github.com/elimt/go-orchestrator/internal/scheduler"
+	"github.com/elimt/go-orchestrator/internal/task"
+	"github.com/google/uuid"
+)
+
+// preempt makes room for task t, which could not be placed, by stopping
+// running tasks of a lower priority. It picks the healthy node where the
+// fewest tasks need to be stopped for t to fit, preferring the node whose
+// victims have the lowest priority, and requeues the tasks it stops as new
+// pending tasks. It reports whether any tasks were preempted.
+func (m *Manager) preempt(t task.Task) bool {
+	if t.PreemptionPolicy == task.PreemptNever {
+		return false
+	}
+
+	m.jobMu.Lock()
+	defer m.jobMu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	nodes := m.healthyNodes()
+	var target *node.Node
+	var victims []*task.Task
+	for i, n := range nodes {
+		v := m.victims(t, nodes, i)
+		if len(v) == 0 {
+			continue
+		}
+		if target == nil || len(v) < len(victims) ||
+			(len(v) == len(victims) && highestPriority(v) < highestPriority(victims)) {
+			target, victims = n, v
+		}
+	}
+	if target == nil {
+		return false
+	}
+
+	for _, v := range victims {
+		m.evict(v, t)
+	}
+	m.updateAllocation(target)
+	return true
+}
+
+// victims returns the tasks to stop on nodes[i] for task t to be placed
+// there, or nil if stopping every task t may preempt would not make room.
+// Tasks of the lowest priority, and among those the most recently started,
+// are chosen first, and no more are chosen than needed. Callers must hold
+// m.mu.
+func (m *Manager) victims(t task.Task, nodes []*node.Node, i int) []*task.Task {
+	n := nodes[i]
+	var active, candidates []*task.Task
+	for _, id := range m.WorkerTaskMap[n.Name] {
+		other, err := m.getTask(id)
+		if err != nil || !other.Active() {
+			continue
+		}
+		active = append(active, other)
+		if other.State == task.Running && t.CanPreempt(other) {
+			candidates = append(candidates, other)
+		}
+	}
+	sort.Slice(candidates, func(a, b int) bool {
+		if candidates[a].Priority != candidates[b].Priority {
+			return candidates[a].Priority < candidates[b].Priority
+		}
+		return candidates[a].StartTime.After(candidates[b].StartTime)
+	})
+
+	// Try the task on a copy of the node that runs only the tasks that are
+	// left, so spread rules still see the rest of the cluster.
+	probe := *n
+	trial := make([]*node.Node, len(nodes))
+	copy(trial, nodes)
+	trial[i] = &probe
+
+	stopped := make(map[uuid.UUID]bool)
+	for k, v := range candidates {
+		stopped[v.ID] = true
+		probe.MemoryAllocated, probe.DiskAllocated, probe.CPUAllocated = 0, 0, 0
+		probe.TaskLabels = nil
+		for _, other := range active {
+			if !stopped[other.ID] {
+				assign(&probe, other)
+			}
+		}
+		if scheduler.Reasons(t, trial)[i] == "" {
+			return candidates[:k+1]
+		}
+	}
+	return nil
+}
+
+func highestPriority(tasks []*task.Task) int {
+	highest := tasks[0].Priority
+	for _, t := range tasks[1:] {
+		if t.Priority > highest {
+			highest = t.Priority
+		}
+	}
+	return highest
+}
+
+// evict stops victim to make room for task t and requeues it as a new
+// pending task, which takes the victim's place in its job. The victim is
+// marked completed at once so its resources count as free. Callers must
+// hold m.jobMu and m.mu.
+func (m *Manager) evict(victim *task.Task, t task.Task) {
+	requeued := rerun(victim)
+	requeued.Reason = fmt.Sprintf("preempted by %s", t.Name)
+
+	if victim.JobID != uuid.Nil {
+		j, err := m.getJob(victim.JobID)
+		if err != nil {
+			fmt.Printf("Error getting job %v of task %v: %v\n", victim.JobID, victim.ID, err)
+		} else if i := indexOf(j.TaskIDs, victim.ID); i >= 0 {
+			j.TaskIDs[i] = requeued.ID
+			err = m.JobDB.Put(j.ID.String(), j)
+			if err != nil {
+				fmt.Printf("Error storing job %v: %v\n", j.ID, err)
+			}
+		}
+	}
+	m.submitTask(requeued)
+
+	victim.State = task.Completed
+	victim.Stopped = true
+	victim.Reason = fmt.Sprintf("preempted by %s, requeued as %v", t.Name, requeued.ID)
+	victim.FinishTime = time.Now().UTC()
+	err := m.TaskDB.Put(victim.ID.String(), victim)
+	if err != nil {
+		fmt.Printf("Error storing task %v: %v\n", victim.ID, err)
+	}
+
+	m.enqueue(task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Completed,
+		Timestamp: time.Now().UTC(),
+		Task:      *victim,
+	})
+	fmt.Printf("Preempted task %v (priority %d) for task %v (priority %d), requeued as %v\n",
+		victim.ID, victim.Priority, t.ID, t.Priority, requeued.ID)
+}
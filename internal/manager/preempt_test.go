@@ -0,0 +1,173 @@
+package manager
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elimt/go-orchestrator/internal/node"
+	"github.com/elimt/go-orchestrator/internal/task"
+	"github.com/google/uuid"
+)
+
+// place stores a task running on worker n and counts it against the node.
+func place(t *testing.T, m *Manager, n *node.Node, tk task.Task) *task.Task {
+	t.Helper()
+	tk.ID = uuid.New()
+	tk.State = task.Running
+	err := m.TaskDB.Put(tk.ID.String(), &tk)
+	if err != nil {
+		t.Fatalf("storing task %s: %v", tk.Name, err)
+	}
+	m.WorkerTaskMap[n.Name] = append(m.WorkerTaskMap[n.Name], tk.ID)
+	m.TaskWorkerMap[tk.ID] = n.Name
+	m.updateAllocation(n)
+	return &tk
+}
+
+// newPreemptManager returns a manager with two workers of two cores each.
+// w1 runs two low priority tasks, the second started later, and w2 a low
+// and a normal priority task; each task asks for a core.
+func newPreemptManager(t *testing.T) *Manager {
+	t.Helper()
+	m := newTestManager(t, "w1", "w2")
+	w1, w2 := m.WorkerNodes[0], m.WorkerNodes[1]
+	w1.Cores, w2.Cores = 2, 2
+
+	start := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+	running := func(name string, priority int, started time.Duration) task.Task {
+		return task.Task{Name: name, Priority: priority, CPU: 1, StartTime: start.Add(started)}
+	}
+	place(t, m, w1, running("low-1", 100, 0))
+	place(t, m, w1, running("low-2", 100, time.Minute))
+	place(t, m, w2, running("low-3", 100, 0))
+	place(t, m, w2, running("normal", 500, 0))
+	return m
+}
+
+func TestVictims(t *testing.T) {
+	tests := []struct {
+		name string
+		task task.Task
+		node int
+		want []string
+	}{
+		{
+			name: "most recently started first",
+			task: task.Task{Name: "t", Priority: 1000, CPU: 1},
+			node: 0,
+			want: []string{"low-2"},
+		},
+		{
+			name: "no more than needed",
+			task: task.Task{Name: "t", Priority: 1000, CPU: 2},
+			node: 0,
+			want: []string{"low-2", "low-1"},
+		},
+		{
+			name: "lowest priority first",
+			task: task.Task{Name: "t", Priority: 1000, CPU: 2},
+			node: 1,
+			want: []string{"low-3", "normal"},
+		},
+		{
+			name: "only lower priorities",
+			task: task.Task{Name: "t", Priority: 500, CPU: 2},
+			node: 1,
+		},
+		{
+			name: "equal priority is not preempted",
+			task: task.Task{Name: "t", Priority: 100, CPU: 1},
+			node: 0,
+		},
+		{
+			name: "never preempts",
+			task: task.Task{Name: "t", Priority: 1000, CPU: 1, PreemptionPolicy: task.PreemptNever},
+			node: 0,
+		},
+		{
+			name: "no room even when empty",
+			task: task.Task{Name: "t", Priority: 1000, CPU: 3},
+			node: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newPreemptManager(t)
+			var got []string
+			for _, v := range m.victims(tt.task, m.WorkerNodes, tt.node) {
+				got = append(got, v.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("victims = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreempt(t *testing.T) {
+	m := newPreemptManager(t)
+	high := task.Task{ID: uuid.New(), Name: "high", Priority: 1000, CPU: 1}
+	if !m.preempt(high) {
+		t.Fatal("preempt returned false, want a task preempted")
+	}
+
+	// Both workers need one task stopped, of the same priority, so the
+	// first is chosen.
+	if got := m.WorkerNodes[0].CPUAllocated; got != 1 {
+		t.Errorf("w1 has %v cores allocated after preempting, want 1", got)
+	}
+	if got := m.WorkerNodes[1].CPUAllocated; got != 2 {
+		t.Errorf("w2 has %v cores allocated, want 2", got)
+	}
+
+	tasks, err := m.listTasks()
+	if err != nil {
+		t.Fatalf("listing tasks: %v", err)
+	}
+	var victim, requeued *task.Task
+	for _, tk := range tasks {
+		if tk.Name != "low-2" {
+			continue
+		}
+		if tk.State == task.Pending {
+			requeued = tk
+		} else {
+			victim = tk
+		}
+	}
+	if victim == nil || victim.State != task.Completed || !victim.Stopped {
+		t.Fatalf("victim = %+v, want low-2 completed and stopped", victim)
+	}
+	if requeued == nil || requeued.Reason != "preempted by high" {
+		t.Fatalf("requeued = %+v, want a pending low-2 preempted by high", requeued)
+	}
+
+	// The stop goes out before the requeued task is placed again.
+	batch := m.dequeueBatch(m.BatchSize)
+	if len(batch) != 2 {
+		t.Fatalf("%d events queued, want 2", len(batch))
+	}
+	if batch[0].State != task.Completed || batch[0].Task.ID != victim.ID {
+		t.Errorf("first event stops %v in state %v, want a stop of %v", batch[0].Task.ID, batch[0].State, victim.ID)
+	}
+	if batch[1].State != task.Scheduled || batch[1].Task.ID != requeued.ID {
+		t.Errorf("second event starts %v in state %v, want %v scheduled", batch[1].Task.ID, batch[1].State, requeued.ID)
+	}
+}
+
+func TestPreemptNothingToStop(t *testing.T) {
+	m := newPreemptManager(t)
+	for _, tk := range []task.Task{
+		{Name: "never", Priority: 10000, CPU: 1, PreemptionPolicy: task.PreemptNever},
+		{Name: "low", Priority: 100, CPU: 1},
+		{Name: "huge", Priority: 10000, CPU: 3},
+	} {
+		if m.preempt(tk) {
+			t.Errorf("preempt(%s) returned true, want no tasks preempted", tk.Name)
+		}
+	}
+	if n := m.PendingCount(); n != 0 {
+		t.Errorf("%d events queued, want none", n)
+	}
+}
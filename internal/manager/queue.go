@@ -0,0 +1,212 @@
+package manager
+
+import (
+	"container/heap"
+	"sort"
+	"time"
+
+	"github.com/elimt/go-orchestrator/internal/task"
+)
+
+// TaskQueue holds task events waiting to be sent to workers. Events to
+// stop tasks come off it first, as they free up resources, then events to
+// start tasks, highest priority first. Events of the same priority come
+// off in the order they were added.
+type TaskQueue struct {
+	items queueItems
+	seq   uint64
+}
+
+type queueItem struct {
+	te  task.TaskEvent
+	seq uint64
+}
+
+type queueItems []queueItem
+
+func (q queueItems) Len() int { return len(q) }
+
+func (q queueItems) Less(i, k int) bool {
+	si, sk := q[i].te.State == task.Completed, q[k].te.State == task.Completed
+	if si != sk {
+		return si
+	}
+	if pi, pk := q[i].te.Task.Priority, q[k].te.Task.Priority; pi != pk {
+		return pi > pk
+	}
+	return q[i].seq < q[k].seq
+}
+
+func (q queueItems) Swap(i, k int) { q[i], q[k] = q[k], q[i] }
+
+func (q *queueItems) Push(x interface{}) { *q = append(*q, x.(queueItem)) }
+
+func (q *queueItems) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// Enqueue adds an event to the queue.
+func (q *TaskQueue) Enqueue(te task.TaskEvent) {
+	q.seq++
+	heap.Push(&q.items, queueItem{te: te, seq: q.seq})
+}
+
+// Dequeue takes the next event off the queue. It must not be called on an
+// empty queue.
+func (q *TaskQueue) Dequeue() task.TaskEvent {
+	return heap.Pop(&q.items).(queueItem).te
+}
+
+// Len returns the number of events in the queue.
+func (q *TaskQueue) Len() int {
+	return len(q.items)
+}
+
+// peek returns the next event without taking it off the queue. It must not
+// be called on an empty queue.
+func (q *TaskQueue) peek() task.TaskEvent {
+	return q.items[0].te
+}
+
+// oldest returns the earliest timestamp of the events in the queue, or the
+// zero time if it is empty.
+func (q *TaskQueue) oldest() time.Time {
+	var oldest time.Time
+	for _, item := range q.items {
+		ts := item.te.Timestamp
+		if !ts.IsZero() && (oldest.IsZero() || ts.Before(oldest)) {
+			oldest = ts
+		}
+	}
+	return oldest
+}
+
+// FairQueue holds the task events waiting to be sent to workers in a
+// TaskQueue for each tenant, so that one tenant's burst of submissions
+// doesn't hold up everyone else's. Events to stop tasks come off first,
+// whichever tenant they belong to. Events to start tasks are taken from
+// the tenants with pending work in proportion to their weights, and from
+// each tenant in the order its TaskQueue gives them.
+type FairQueue struct {
+	// Weights gives each tenant's share of dispatches. Tenants that aren't
+	// listed have a weight of 1.
+	Weights map[string]int
+
+	tenants map[string]*tenantQueue
+	// now is the pass of the tenant last dequeued from. A tenant whose
+	// queue was empty starts from it, so it can't save up the turns it
+	// had nothing to take.
+	now float64
+}
+
+// tenantQueue is a tenant's events and its place in the fair order. Each
+// event taken from the queue moves its pass on by 1/weight, and the tenant
+// with the lowest pass goes next.
+type tenantQueue struct {
+	queue      TaskQueue
+	pass       float64
+	dispatched int
+	waited     time.Duration
+}
+
+func tenantOf(te task.TaskEvent) string {
+	if te.Task.Tenant == "" {
+		return task.DefaultTenant
+	}
+	return te.Task.Tenant
+}
+
+// Weight returns the weight of tenant.
+func (q *FairQueue) Weight(tenant string) int {
+	if w, ok := q.Weights[tenant]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+// Enqueue adds an event to its tenant's queue.
+func (q *FairQueue) Enqueue(te task.TaskEvent) {
+	if q.tenants == nil {
+		q.tenants = make(map[string]*tenantQueue)
+	}
+	name := tenantOf(te)
+	tq, ok := q.tenants[name]
+	if !ok {
+		tq = &tenantQueue{}
+		q.tenants[name] = tq
+	}
+	if tq.queue.Len() == 0 && tq.pass < q.now {
+		tq.pass = q.now
+	}
+	tq.queue.Enqueue(te)
+}
+
+// Dequeue takes the next event off the queue. It must not be called on an
+// empty queue.
+func (q *FairQueue) Dequeue() task.TaskEvent {
+	var next *tenantQueue
+	var nextName string
+	for name, tq := range q.tenants {
+		if tq.queue.Len() == 0 {
+			continue
+		}
+		if tq.queue.peek().State == task.Completed {
+			return tq.queue.Dequeue()
+		}
+		if next == nil || tq.pass < next.pass || (tq.pass == next.pass && name < nextName) {
+			next, nextName = tq, name
+		}
+	}
+
+	q.now = next.pass
+	next.pass += 1 / float64(q.Weight(nextName))
+	return next.queue.Dequeue()
+}
+
+// Len returns the number of events in the queue.
+func (q *FairQueue) Len() int {
+	n := 0
+	for _, tq := range q.tenants {
+		n += tq.queue.Len()
+	}
+	return n
+}
+
+// Dispatched records that the task of te was sent to a worker at time at,
+// having waited since the event's timestamp.
+func (q *FairQueue) Dispatched(te task.TaskEvent, at time.Time) {
+	tq, ok := q.tenants[tenantOf(te)]
+	if !ok || te.Timestamp.IsZero() {
+		return
+	}
+	tq.dispatched++
+	tq.waited += at.Sub(te.Timestamp)
+}
+
+// Tenants reports on the queue of every tenant that has queued work, by
+// tenant name.
+func (q *FairQueue) Tenants(now time.Time) []task.TenantQueue {
+	tenants := make([]task.TenantQueue, 0, len(q.tenants))
+	for name, tq := range q.tenants {
+		tenant := task.TenantQueue{
+			Tenant:     name,
+			Weight:     q.Weight(name),
+			Pending:    tq.queue.Len(),
+			Dispatched: tq.dispatched,
+		}
+		if oldest := tq.queue.oldest(); !oldest.IsZero() {
+			tenant.OldestWait = now.Sub(oldest)
+		}
+		if tq.dispatched > 0 {
+			tenant.AverageWait = tq.waited / time.Duration(tq.dispatched)
+		}
+		tenants = append(tenants, tenant)
+	}
+	sort.Slice(tenants, func(i, k int) bool {
+		return tenants[i].Tenant < tenants[k].Tenant
+	})
+	return tenants
+}
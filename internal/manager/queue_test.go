@@ -0,0 +1,199 @@
+package manager
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elimt/go-orchestrator/internal/task"
+)
+
+// event returns an event for a task named name with the given state and
+// priority.
+func event(name string, state task.State, priority int) task.TaskEvent {
+	return task.TaskEvent{State: state, Task: task.Task{Name: name, Priority: priority}}
+}
+
+// tenantEvent returns an event to start a task of tenant, named after the
+// tenant.
+func tenantEvent(tenant string) task.TaskEvent {
+	return task.TaskEvent{State: task.Scheduled, Task: task.Task{Name: tenant, Tenant: tenant}}
+}
+
+// drain dequeues n events and returns the names of their tasks joined
+// together.
+func drain(q *FairQueue, n int) string {
+	var names []string
+	for i := 0; i < n; i++ {
+		names = append(names, q.Dequeue().Task.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestTaskQueueOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []task.TaskEvent
+		want   []string
+	}{
+		{
+			name: "fifo within a priority",
+			events: []task.TaskEvent{
+				event("a", task.Scheduled, 500),
+				event("b", task.Scheduled, 500),
+				event("c", task.Scheduled, 500),
+			},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "highest priority first",
+			events: []task.TaskEvent{
+				event("low", task.Scheduled, 100),
+				event("normal", task.Scheduled, 500),
+				event("critical", task.Scheduled, 10000),
+				event("high", task.Scheduled, 1000),
+			},
+			want: []string{"critical", "high", "normal", "low"},
+		},
+		{
+			name: "stops first",
+			events: []task.TaskEvent{
+				event("start", task.Scheduled, 10000),
+				event("stop low", task.Completed, 100),
+				event("stop high", task.Completed, 1000),
+			},
+			want: []string{"stop high", "stop low", "start"},
+		},
+		{
+			name: "ties keep their order among others",
+			events: []task.TaskEvent{
+				event("a", task.Scheduled, 100),
+				event("b", task.Scheduled, 500),
+				event("c", task.Scheduled, 100),
+				event("d", task.Scheduled, 500),
+				event("e", task.Completed, 0),
+			},
+			want: []string{"e", "b", "d", "a", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var q TaskQueue
+			for _, te := range tt.events {
+				q.Enqueue(te)
+			}
+			var got []string
+			for q.Len() > 0 {
+				got = append(got, q.Dequeue().Task.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dequeued %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFairQueueOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights map[string]int
+		events  []task.TaskEvent
+		want    string
+	}{
+		{
+			name:   "equal weights alternate",
+			events: []task.TaskEvent{tenantEvent("a"), tenantEvent("a"), tenantEvent("a"), tenantEvent("b")},
+			want:   "a b a a",
+		},
+		{
+			name:    "weights 3 to 1",
+			weights: map[string]int{"a": 3},
+			events: []task.TaskEvent{
+				tenantEvent("a"), tenantEvent("a"), tenantEvent("a"), tenantEvent("a"),
+				tenantEvent("a"), tenantEvent("a"), tenantEvent("a"),
+				tenantEvent("b"), tenantEvent("b"), tenantEvent("b"),
+			},
+			want: "a b a a a b a a a b",
+		},
+		{
+			name: "stops first whatever the tenant",
+			events: []task.TaskEvent{
+				tenantEvent("a"),
+				tenantEvent("b"),
+				{State: task.Completed, Task: task.Task{Name: "stop", Tenant: "b"}},
+			},
+			want: "stop a b",
+		},
+		{
+			name: "priority within a tenant",
+			events: []task.TaskEvent{
+				tenantEvent("a"),
+				{State: task.Scheduled, Task: task.Task{Name: "urgent", Tenant: "a", Priority: 1000}},
+				tenantEvent("b"),
+			},
+			want: "urgent b a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := FairQueue{Weights: tt.weights}
+			for _, te := range tt.events {
+				q.Enqueue(te)
+			}
+			if got := drain(&q, len(tt.events)); got != tt.want {
+				t.Errorf("dequeued %q, want %q", got, tt.want)
+			}
+			if q.Len() != 0 {
+				t.Errorf("%d events left, want none", q.Len())
+			}
+		})
+	}
+}
+
+func TestFairQueueIdleTenant(t *testing.T) {
+	var q FairQueue
+	for i := 0; i < 8; i++ {
+		q.Enqueue(tenantEvent("a"))
+	}
+	if got := drain(&q, 4); got != "a a a a" {
+		t.Fatalf("dequeued %q, want a alone", got)
+	}
+
+	// b had nothing queued while a took its turns, so it shares from now
+	// on rather than taking every turn until it has caught up.
+	for i := 0; i < 4; i++ {
+		q.Enqueue(tenantEvent("b"))
+	}
+	if got, want := drain(&q, 8), "b a b a b a b a"; got != want {
+		t.Errorf("dequeued %q, want %q", got, want)
+	}
+}
+
+func TestFairQueueTenants(t *testing.T) {
+	start := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+	q := FairQueue{Weights: map[string]int{"b": 2}}
+	queue := func(tenant string, at time.Duration) {
+		te := tenantEvent(tenant)
+		te.Timestamp = start.Add(at)
+		q.Enqueue(te)
+	}
+	queue("b", 0)
+	queue("b", time.Second)
+	queue("", 2*time.Second)
+	queue("b", 3*time.Second)
+
+	// b goes first, its pass moving on by a half, then the default tenant.
+	for _, at := range []time.Duration{4 * time.Second, 6 * time.Second} {
+		q.Dispatched(q.Dequeue(), start.Add(at))
+	}
+
+	want := []task.TenantQueue{
+		{Tenant: "b", Weight: 2, Pending: 2, OldestWait: 9 * time.Second, Dispatched: 1, AverageWait: 4 * time.Second},
+		{Tenant: task.DefaultTenant, Weight: 1, Pending: 0, Dispatched: 1, AverageWait: 4 * time.Second},
+	}
+	got := q.Tenants(start.Add(10 * time.Second))
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Tenants = %+v, want %+v", got, want)
+	}
+}
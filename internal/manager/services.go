@@ -0,0 +1,536 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/elimt/go-orchestrator/internal/task"
+	"github.com/google/uuid"
+)
+
+// ErrServiceExists is returned when a service is created with the name of an
+// existing service.
+var ErrServiceExists = errors.New("service already exists")
+
+// ErrNoPreviousRevision is returned when a service that has never been
+// updated is rolled back.
+var ErrNoPreviousRevision = errors.New("service has no previous revision")
+
+// CreateService creates a service from svc, which gives its name, replicas,
+// template and update strategy, and starts its replicas.
+func (m *Manager) CreateService(svc task.Service) (*task.Service, error) {
+	m.serviceMu.Lock()
+	defer m.serviceMu.Unlock()
+
+	services, err := m.listServices()
+	if err != nil {
+		return nil, err
+	}
+	for _, existing := range services {
+		if existing.Name == svc.Name {
+			return nil, fmt.Errorf("%w: %s, update or remove it instead", ErrServiceExists, svc.Name)
+		}
+	}
+
+	now := time.Now().UTC()
+	svc.ID = uuid.New()
+	svc.Revision = 1
+	svc.CreatedAt = now
+	svc.UpdatedAt = now
+	err = m.ServiceDB.Put(svc.ID.String(), &svc)
+	if err != nil {
+		return nil, fmt.Errorf("error storing service %v: %w", svc.ID, err)
+	}
+
+	fmt.Printf("Created service %v (%s) with %d replicas\n", svc.ID, svc.Name, svc.Replicas)
+	m.reconcileService(&svc)
+	return m.GetService(svc.ID)
+}
+
+// UpdateService changes the replicas, template and update strategy of a
+// service to those of update. If the template changed, a rolling update
+// replaces the service's tasks with ones started from the new template.
+func (m *Manager) UpdateService(id uuid.UUID, update task.Service) (*task.Service, error) {
+	m.serviceMu.Lock()
+	defer m.serviceMu.Unlock()
+
+	svc, err := m.getService(id)
+	if err != nil {
+		return nil, err
+	}
+	svc.Replicas = update.Replicas
+	svc.Update = update.Update
+	svc.UpdatedAt = time.Now().UTC()
+
+	if !sameTemplate(svc.Template, update.Template) {
+		next := svc.Revision
+		if svc.PreviousRevision > next {
+			next = svc.PreviousRevision
+		}
+		previous := svc.Template
+		svc.PreviousTemplate = &previous
+		svc.PreviousRevision = svc.Revision
+		svc.Template = update.Template
+		svc.Revision = next + 1
+		svc.UpdateStatus = &task.UpdateStatus{
+			State:     task.UpdateInProgress,
+			StartedAt: svc.UpdatedAt,
+		}
+		fmt.Printf("Updating service %v (%s) to revision %d\n", svc.ID, svc.Name, svc.Revision)
+	}
+
+	err = m.ServiceDB.Put(svc.ID.String(), svc)
+	if err != nil {
+		return nil, fmt.Errorf("error storing service %v: %w", svc.ID, err)
+	}
+	m.reconcileService(svc)
+	return m.GetService(id)
+}
+
+// RollbackService returns a service to the template it used before its last
+// update, replacing its tasks the same way an update does.
+func (m *Manager) RollbackService(id uuid.UUID) (*task.Service, error) {
+	m.serviceMu.Lock()
+	defer m.serviceMu.Unlock()
+
+	svc, err := m.getService(id)
+	if err != nil {
+		return nil, err
+	}
+	if svc.PreviousTemplate == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoPreviousRevision, svc.Name)
+	}
+
+	m.rollback(svc, "rollback requested")
+	err = m.ServiceDB.Put(svc.ID.String(), svc)
+	if err != nil {
+		return nil, fmt.Errorf("error storing service %v: %w", svc.ID, err)
+	}
+	m.reconcileService(svc)
+	return m.GetService(id)
+}
+
+// rollback swaps the service's template with the previous one and starts
+// replacing its tasks.
+func (m *Manager) rollback(svc *task.Service, reason string) {
+	previous := svc.Template
+	svc.Template = *svc.PreviousTemplate
+	svc.PreviousTemplate = &previous
+	svc.Revision, svc.PreviousRevision = svc.PreviousRevision, svc.Revision
+
+	now := time.Now().UTC()
+	svc.UpdatedAt = now
+	svc.UpdateStatus = &task.UpdateStatus{
+		State:     task.UpdateRollingBack,
+		StartedAt: now,
+		Reason:    reason,
+	}
+	fmt.Printf("Rolling service %v (%s) back to revision %d: %s\n", svc.ID, svc.Name, svc.Revision, reason)
+}
+
+// sameTemplate reports whether two templates would start identical tasks.
+func sameTemplate(a, b task.Task) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
+
+// ScaleService changes the number of replicas of a service and starts or
+// stops tasks to match.
+func (m *Manager) ScaleService(id uuid.UUID, replicas int) (*task.Service, error) {
+	if replicas < 0 {
+		return nil, fmt.Errorf("replicas must not be negative")
+	}
+
+	m.serviceMu.Lock()
+	defer m.serviceMu.Unlock()
+
+	svc, err := m.getService(id)
+	if err != nil {
+		return nil, err
+	}
+	svc.Replicas = replicas
+	svc.UpdatedAt = time.Now().UTC()
+	err = m.ServiceDB.Put(svc.ID.String(), svc)
+	if err != nil {
+		return nil, fmt.Errorf("error storing service %v: %w", svc.ID, err)
+	}
+
+	fmt.Printf("Scaled service %v (%s) to %d replicas\n", svc.ID, svc.Name, replicas)
+	m.reconcileService(svc)
+	return m.GetService(id)
+}
+
+// RemoveService stops every task of a service and deletes it.
+func (m *Manager) RemoveService(id uuid.UUID) error {
+	m.serviceMu.Lock()
+	defer m.serviceMu.Unlock()
+
+	svc, err := m.getService(id)
+	if err != nil {
+		return err
+	}
+	for _, t := range m.serviceTasks(id) {
+		err := m.StopTask(t.ID)
+		if err != nil {
+			fmt.Printf("Error stopping task %v of service %v: %v\n", t.ID, id, err)
+		}
+		delete(m.stopping, t.ID)
+	}
+	err = m.ServiceDB.Delete(id.String())
+	if err != nil {
+		return fmt.Errorf("error deleting service %v: %w", id, err)
+	}
+	fmt.Printf("Removed service %v (%s)\n", svc.ID, svc.Name)
+	return nil
+}
+
+func (m *Manager) getService(id uuid.UUID) (*task.Service, error) {
+	result, err := m.ServiceDB.Get(id.String())
+	if err != nil {
+		return nil, err
+	}
+	svc, ok := result.(*task.Service)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert %v to task.Service", result)
+	}
+	return svc, nil
+}
+
+func (m *Manager) listServices() ([]*task.Service, error) {
+	result, err := m.ServiceDB.List()
+	if err != nil {
+		return nil, err
+	}
+	services, ok := result.([]*task.Service)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert %v to a list of services", result)
+	}
+	sort.Slice(services, func(i, k int) bool {
+		return services[i].CreatedAt.Before(services[k].CreatedAt)
+	})
+	return services, nil
+}
+
+// GetService returns the service with its unfinished tasks.
+func (m *Manager) GetService(id uuid.UUID) (*task.Service, error) {
+	svc, err := m.getService(id)
+	if err != nil {
+		return nil, err
+	}
+	m.fillService(svc)
+	return svc, nil
+}
+
+// GetServices returns every service, oldest first, with its unfinished
+// tasks.
+func (m *Manager) GetServices() []*task.Service {
+	services, err := m.listServices()
+	if err != nil {
+		fmt.Printf("Error getting list of services: %v\n", err)
+		return nil
+	}
+	for _, svc := range services {
+		m.fillService(svc)
+	}
+	return services
+}
+
+func (m *Manager) fillService(svc *task.Service) {
+	svc.Tasks = m.serviceTasks(svc.ID)
+	svc.Running = 0
+	for _, t := range svc.Tasks {
+		if t.State == task.Running {
+			svc.Running++
+		}
+	}
+}
+
+// serviceTasks returns the unfinished tasks of a service, oldest first.
+func (m *Manager) serviceTasks(id uuid.UUID) []*task.Task {
+	tasks, err := m.listTasks()
+	if err != nil {
+		fmt.Printf("Error getting list of tasks: %v\n", err)
+		return nil
+	}
+
+	var active []*task.Task
+	for _, t := range tasks {
+		if t.ServiceID == id && t.Active() {
+			active = append(active, t)
+		}
+	}
+	sort.Slice(active, func(i, k int) bool {
+		return active[i].StartTime.Before(active[k].StartTime)
+	})
+	return active
+}
+
+// ReconcileServices periodically starts and stops tasks so that every
+// service has as many replicas as it asks for, replacing tasks that have
+// finished, failed or been stopped.
+func (m *Manager) ReconcileServices() {
+	for {
+		m.reconcileServices()
+		time.Sleep(m.ReconcileInterval)
+	}
+}
+
+func (m *Manager) reconcileServices() {
+	m.serviceMu.Lock()
+	defer m.serviceMu.Unlock()
+
+	services, err := m.listServices()
+	if err != nil {
+		fmt.Printf("Error getting list of services: %v\n", err)
+		return
+	}
+	for _, svc := range services {
+		m.reconcileService(svc)
+	}
+}
+
+// reconcileService starts and stops tasks so that the service has Replicas
+// tasks that are running or about to, rolling out template changes while an
+// update is in progress. Callers must hold m.serviceMu.
+func (m *Manager) reconcileService(svc *task.Service) {
+	tasks, err := m.listTasks()
+	if err != nil {
+		fmt.Printf("Error getting list of tasks: %v\n", err)
+		return
+	}
+
+	var replicas, failed []*task.Task
+	for _, t := range tasks {
+		if t.ServiceID != svc.ID {
+			continue
+		}
+		if !t.Active() {
+			delete(m.stopping, t.ID)
+			if t.State == task.Failed {
+				failed = append(failed, t)
+			}
+			continue
+		}
+		if !m.stopping[t.ID] {
+			replicas = append(replicas, t)
+		}
+	}
+
+	if svc.UpdateStatus.Active() {
+		m.rollOut(svc, replicas, failed)
+		return
+	}
+	m.scaleService(svc, replicas)
+}
+
+// scaleService starts or stops tasks until the service has Replicas of
+// them. When scaling down, tasks that have not started yet are stopped
+// first, then those of older revisions, then the newest ones.
+func (m *Manager) scaleService(svc *task.Service, replicas []*task.Task) {
+	switch {
+	case len(replicas) < svc.Replicas:
+		missing := svc.Replicas - len(replicas)
+		fmt.Printf("Service %s has %d of %d replicas, starting %d\n", svc.Name, len(replicas), svc.Replicas, missing)
+		m.startReplicas(svc, missing)
+
+	case len(replicas) > svc.Replicas:
+		surplus := len(replicas) - svc.Replicas
+		fmt.Printf("Service %s has %d of %d replicas, stopping %d\n", svc.Name, len(replicas), svc.Replicas, surplus)
+		sort.Slice(replicas, func(i, k int) bool {
+			pi, pk := replicas[i].State == task.Pending, replicas[k].State == task.Pending
+			if pi != pk {
+				return pi
+			}
+			oi, ok := replicas[i].Revision != svc.Revision, replicas[k].Revision != svc.Revision
+			if oi != ok {
+				return oi
+			}
+			return replicas[i].StartTime.After(replicas[k].StartTime)
+		})
+		for _, t := range replicas[:surplus] {
+			m.stopReplica(svc, t)
+		}
+	}
+}
+
+// rollOut advances the service's update by one step. The next batch is
+// started once every task of the new revision has been ready for the
+// Monitor period and Delay has passed since the last batch. Each batch
+// replaces as many old tasks as MaxSurge and MaxUnavailable allow. The
+// update fails if a task of the new revision fails, turns unhealthy or is
+// not ready within Timeout.
+func (m *Manager) rollOut(svc *task.Service, replicas []*task.Task, failed []*task.Task) {
+	st := svc.UpdateStatus
+	now := time.Now().UTC()
+	p, reason := updateProgress(svc, replicas, failed, now)
+	st.Updated = len(p.current) - p.waiting
+
+	switch {
+	case reason != "":
+		m.failUpdate(svc, reason)
+
+	case p.waiting > 0:
+		st.Message = fmt.Sprintf("waiting for %d new tasks to become healthy", p.waiting)
+
+	case len(p.old) == 0 && len(p.current) >= svc.Replicas:
+		st.Message = ""
+		st.CompletedAt = now
+		if st.State == task.UpdateRollingBack {
+			st.State = task.UpdateRolledBack
+		} else {
+			st.State = task.UpdateCompleted
+		}
+		fmt.Printf("Service %s is running revision %d on all replicas\n", svc.Name, svc.Revision)
+		m.scaleService(svc, replicas)
+
+	case now.Sub(st.BatchStartedAt) < svc.Update.Delay:
+		st.Message = fmt.Sprintf("waiting %v before the next batch", svc.Update.Delay-now.Sub(st.BatchStartedAt))
+
+	default:
+		m.startBatch(svc, p.ready, p.current, p.old)
+	}
+
+	err := m.ServiceDB.Put(svc.ID.String(), svc)
+	if err != nil {
+		fmt.Printf("Error storing service %v: %v\n", svc.ID, err)
+	}
+}
+
+// rollOutProgress is where a service's update stands: the replicas of the
+// new revision and of older ones, how many replicas are ready, and how
+// many of the new ones have yet to be ready for the Monitor period.
+type rollOutProgress struct {
+	current []*task.Task
+	old     []*task.Task
+	ready   int
+	waiting int
+}
+
+// updateProgress sorts the service's replicas by revision for rollOut. It
+// also returns why the update has failed, if it has.
+func updateProgress(svc *task.Service, replicas, failed []*task.Task, now time.Time) (rollOutProgress, string) {
+	st := svc.UpdateStatus
+	var p rollOutProgress
+	reason := ""
+	for _, t := range replicas {
+		if t.Ready() {
+			p.ready++
+		}
+		if t.Revision != svc.Revision {
+			p.old = append(p.old, t)
+			continue
+		}
+		p.current = append(p.current, t)
+		if !t.Ready() || now.Sub(t.StartTime) < svc.Update.Monitor {
+			p.waiting++
+		}
+		if t.Health == task.Unhealthy {
+			reason = fmt.Sprintf("task %s is unhealthy", t.Name)
+		}
+	}
+	for _, t := range failed {
+		if t.Revision == svc.Revision && t.FinishTime.After(st.StartedAt) {
+			reason = fmt.Sprintf("task %s failed", t.Name)
+		}
+	}
+	// Tasks of the new revision may be waiting before any batch has been
+	// started, such as the old tasks a rollback returns to.
+	batchStart := st.BatchStartedAt
+	if batchStart.IsZero() {
+		batchStart = st.StartedAt
+	}
+	if reason == "" && p.waiting > 0 && now.Sub(batchStart) > svc.Update.Timeout {
+		reason = fmt.Sprintf("%d tasks were not healthy within %v", p.waiting, svc.Update.Timeout)
+	}
+	return p, reason
+}
+
+// startBatch stops the old tasks and starts the new ones of the next batch
+// of an update. Old tasks that are not ready are stopped first as they do
+// not count towards availability.
+func (m *Manager) startBatch(svc *task.Service, ready int, current []*task.Task, old []*task.Task) {
+	sort.Slice(old, func(i, k int) bool {
+		return !old[i].Ready() && old[k].Ready()
+	})
+
+	canStop := ready - (svc.Replicas - svc.Update.MaxUnavailable)
+	var stop []*task.Task
+	for _, t := range old {
+		if t.Ready() {
+			if canStop <= 0 {
+				break
+			}
+			canStop--
+		}
+		stop = append(stop, t)
+	}
+
+	remaining := len(current) + len(old) - len(stop)
+	start := svc.Replicas + svc.Update.MaxSurge - remaining
+	if missing := svc.Replicas - len(current); start > missing {
+		start = missing
+	}
+	if start < 0 {
+		start = 0
+	}
+
+	for _, t := range stop {
+		m.stopReplica(svc, t)
+	}
+	m.startReplicas(svc, start)
+
+	st := svc.UpdateStatus
+	st.BatchStartedAt = time.Now().UTC()
+	st.Message = fmt.Sprintf("replacing tasks, %d of %d updated", len(current), svc.Replicas)
+	fmt.Printf("Service %s update: stopping %d old tasks, starting %d new ones\n", svc.Name, len(stop), start)
+}
+
+// failUpdate rolls a failed update back, or pauses it if its failure action
+// is pause or it was already a rollback.
+func (m *Manager) failUpdate(svc *task.Service, reason string) {
+	st := svc.UpdateStatus
+	rollback := svc.Update.FailureAction == task.UpdateRollback && svc.PreviousTemplate != nil
+	if st.State == task.UpdateInProgress && rollback {
+		m.rollback(svc, fmt.Sprintf("update to revision %d failed: %s", svc.Revision, reason))
+		return
+	}
+
+	if st.State == task.UpdateRollingBack {
+		reason = "rollback failed: " + reason
+	}
+	st.State = task.UpdatePaused
+	st.Message = ""
+	st.Reason = reason
+	fmt.Printf("Paused update of service %s: %s\n", svc.Name, reason)
+}
+
+// startReplicas starts n tasks from the service's template.
+func (m *Manager) startReplicas(svc *task.Service, n int) {
+	for i := 0; i < n; i++ {
+		t := svc.Template
+		t.ID = uuid.New()
+		t.ServiceID = svc.ID
+		t.Revision = svc.Revision
+		t.Name = fmt.Sprintf("%s-%s", svc.Name, t.ID.String()[:8])
+		m.submitTask(t)
+	}
+	if n > 0 {
+		m.signal()
+	}
+}
+
+// stopReplica stops one of the service's tasks and remembers it is
+// stopping until it finishes.
+func (m *Manager) stopReplica(svc *task.Service, t *task.Task) {
+	err := m.StopTask(t.ID)
+	if err != nil {
+		fmt.Printf("Error stopping task %v of service %v: %v\n", t.ID, svc.ID, err)
+		return
+	}
+	m.stopping[t.ID] = true
+}
@@ -1,13 +1,144 @@
 package node
 
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elimt/go-orchestrator/internal/stats"
+)
+
+// Status is the manager's view of whether a node is alive, based on how
+// recently it sent a heartbeat.
+type Status string
+
+const (
+	Healthy Status = "healthy"
+	Suspect Status = "suspect"
+	Dead    Status = "dead"
+)
+
+// Node is a worker as the manager sees it. Memory is in KiB, as the worker
+// reports it, and Disk in bytes. MemoryAllocated, DiskAllocated and
+// CPUAllocated, in the same units and in cores, are what the tasks the
+// manager placed on the node asked for.
 type Node struct {
 	Name            string
 	IP              string
+	API             string
 	Memory          int
 	MemoryAllocated int
 	Disk            int
 	DiskAllocated   int
+	Stats           stats.Stats
 	TaskCount       int
 	Cores           int
+	CPUAllocated    float64
 	Role            string
+	// Labels describe the node, such as its zone or disk type, for tasks
+	// to be constrained to or to prefer.
+	Labels map[string]string `json:",omitempty"`
+	// TaskLabels are the labels of the unfinished tasks placed on the node,
+	// for task affinity rules. The manager keeps them with the node's
+	// allocations; they are not reported.
+	TaskLabels    []map[string]string `json:"-"`
+	Status        Status
+	LastHeartbeat time.Time
+}
+
+func NewNode(name string, api string, role string) *Node {
+	return &Node{
+		Name:          name,
+		API:           api,
+		Role:          role,
+		Status:        Healthy,
+		LastHeartbeat: time.Now().UTC(),
+	}
+}
+
+// Allocate adds the memory and disk of a task, both in bytes, and its CPU
+// request in cores to what is allocated on the node.
+func (n *Node) Allocate(memory int64, disk int64, cpu float64) {
+	n.MemoryAllocated += int(KiB(memory))
+	n.DiskAllocated += int(disk)
+	n.CPUAllocated += cpu
+}
+
+// FitsCPU reports whether cpu cores fit in the node's unallocated cores. A
+// node that hasn't reported its cores yet is assumed to fit. Cores are
+// compared in thousandths so that requests such as 0.1 add up exactly.
+func (n *Node) FitsCPU(cpu float64) bool {
+	return n.Cores == 0 || millis(n.CPUAllocated)+millis(cpu) <= int64(n.Cores)*1000
+}
+
+func millis(cores float64) int64 {
+	return int64(math.Round(cores * 1000))
+}
+
+// FitsMemory reports whether memory bytes fit in the node's unallocated
+// memory. A node that hasn't reported its memory yet is assumed to fit.
+func (n *Node) FitsMemory(memory int64) bool {
+	return n.Memory == 0 || KiB(memory) <= int64(n.Memory-n.MemoryAllocated)
+}
+
+// FitsDisk reports whether disk bytes fit in the node's unallocated disk. A
+// node that hasn't reported its disk yet is assumed to fit.
+func (n *Node) FitsDisk(disk int64) bool {
+	return n.Disk == 0 || disk <= int64(n.Disk-n.DiskAllocated)
+}
+
+// KiB converts bytes to KiB, the unit of the node's memory, rounding up.
+func KiB(bytes int64) int64 {
+	return (bytes + 1023) / 1024
+}
+
+// Attribute returns the value of one of the node's attributes, such as
+// node.name, node.role or node.labels.zone, for matching task constraints.
+func (n *Node) Attribute(key string) (string, bool) {
+	switch key {
+	case "node.name":
+		return n.Name, true
+	case "node.role":
+		return n.Role, n.Role != ""
+	}
+	if label := strings.TrimPrefix(key, "node.labels."); label != key {
+		v, ok := n.Labels[label]
+		return v, ok
+	}
+	return "", false
+}
+
+// GetStats fetches the latest stats from the worker running on the node and
+// refreshes the node's capacity from them.
+func (n *Node) GetStats() (*stats.Stats, error) {
+	url := fmt.Sprintf("%s/stats", n.API)
+	//nolint:gosec
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to %v: %w", n.API, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error retrieving stats from %v: status %d", n.API, resp.StatusCode)
+	}
+
+	var s stats.Stats
+	err = json.NewDecoder(resp.Body).Decode(&s)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding stats for node %s: %w", n.Name, err)
+	}
+
+	if s.MemStats != nil {
+		n.Memory = int(s.MemTotalKb())
+	}
+	if s.DiskStats != nil {
+		n.Disk = int(s.DiskTotal())
+	}
+	n.Stats = s
+
+	return &n.Stats, nil
 }
@@ -0,0 +1,87 @@
+package scheduler
+
+import (
+	"math"
+
+	"github.com/elimt/go-orchestrator/internal/node"
+	"github.com/elimt/go-orchestrator/internal/task"
+)
+
+const (
+	// LIEB square ice constant
+	// https://en.wikipedia.org/wiki/Lieb%27s_square_ice_constant
+	LIEB = 1.53960071783900203869
+
+	// maxJobs is the number of tasks a node is expected to handle comfortably.
+	maxJobs = 4.0
+)
+
+// Epvm implements the Enhanced Parallel Virtual Machine cost function: each
+// placement is charged by how much it raises a node's CPU and memory load,
+// and the node with the lowest marginal cost wins. Load is what the node
+// last reported using, or what is allocated on it until it has reported,
+// and the task raises it by what it requests.
+type Epvm struct {
+	Name string
+}
+
+func (e *Epvm) SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node {
+	return selectCandidateNodes(t, nodes)
+}
+
+func (e *Epvm) Score(t task.Task, nodes []*node.Node) map[string]float64 {
+	nodeScores := make(map[string]float64)
+	for _, n := range nodes {
+		cpuLoad := calculateCPULoad(n)
+		newCPULoad := cpuLoad + calculateLoad(t.CPU, float64(n.Cores))
+
+		memoryPercentUsed := calculateMemoryLoad(n, 0)
+		newMemPercent := calculateMemoryLoad(n, t.Memory)
+
+		taskLoad := float64(n.TaskCount) / maxJobs
+		newTaskLoad := float64(n.TaskCount+1) / maxJobs
+
+		memCost := math.Pow(LIEB, newMemPercent) + math.Pow(LIEB, newTaskLoad) -
+			math.Pow(LIEB, memoryPercentUsed) - math.Pow(LIEB, taskLoad)
+		cpuCost := math.Pow(LIEB, newCPULoad) + math.Pow(LIEB, newTaskLoad) -
+			math.Pow(LIEB, cpuLoad) - math.Pow(LIEB, taskLoad)
+
+		nodeScores[n.Name] = memCost + cpuCost
+	}
+	return nodeScores
+}
+
+func (e *Epvm) Pick(scores map[string]float64, candidates []*node.Node) *node.Node {
+	return pickLowest(scores, candidates)
+}
+
+// calculateCPULoad returns the node's CPU usage between its last two
+// samples, falling back to the load average per core until it has reported
+// two and to the cores allocated on it when it has reported neither.
+func calculateCPULoad(n *node.Node) float64 {
+	if usage, ok := n.Stats.CPUUsage(); ok {
+		return usage
+	}
+	if n.Stats.LoadStats != nil && n.Cores > 0 {
+		return n.Stats.LoadStats.Last1Min / float64(n.Cores)
+	}
+	return calculateLoad(n.CPUAllocated, float64(n.Cores))
+}
+
+// calculateMemoryLoad returns the share of the node's memory in use once
+// memory more bytes are. Use is what the node last reported, or what is
+// allocated on it until it has reported, both in KiB.
+func calculateMemoryLoad(n *node.Node, memory int64) float64 {
+	used := int64(n.MemoryAllocated)
+	if n.Stats.MemStats != nil {
+		used = int64(n.Stats.MemUsedKb())
+	}
+	return calculateLoad(float64(used+node.KiB(memory)), float64(n.Memory))
+}
+
+func calculateLoad(usage float64, capacity float64) float64 {
+	if capacity == 0 {
+		return 0
+	}
+	return usage / capacity
+}
@@ -0,0 +1,27 @@
+package scheduler
+
+import (
+	"github.com/elimt/go-orchestrator/internal/node"
+	"github.com/elimt/go-orchestrator/internal/task"
+)
+
+// LeastLoaded places tasks on the node currently running the fewest tasks.
+type LeastLoaded struct {
+	Name string
+}
+
+func (l *LeastLoaded) SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node {
+	return selectCandidateNodes(t, nodes)
+}
+
+func (l *LeastLoaded) Score(t task.Task, nodes []*node.Node) map[string]float64 {
+	nodeScores := make(map[string]float64)
+	for _, n := range nodes {
+		nodeScores[n.Name] = float64(n.TaskCount)
+	}
+	return nodeScores
+}
+
+func (l *LeastLoaded) Pick(scores map[string]float64, candidates []*node.Node) *node.Node {
+	return pickLowest(scores, candidates)
+}
@@ -1,7 +1,184 @@
 package scheduler
 
+import (
+	"fmt"
+
+	"github.com/elimt/go-orchestrator/internal/node"
+	"github.com/elimt/go-orchestrator/internal/task"
+)
+
+const (
+	RoundRobinType  = "roundrobin"
+	LeastLoadedType = "leastloaded"
+	EpvmType        = "epvm"
+)
+
+// Scheduler decides which node a task should be placed on. Candidate nodes
+// are selected first, then scored, and the best scoring candidate is picked.
 type Scheduler interface {
-	SelectCandidateNodes()
-	Score()
-	Pick()
+	SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node
+	Score(t task.Task, nodes []*node.Node) map[string]float64
+	Pick(scores map[string]float64, candidates []*node.Node) *node.Node
+}
+
+// New returns the scheduler registered under name.
+func New(name string) (Scheduler, error) {
+	switch name {
+	case RoundRobinType, "":
+		return &RoundRobin{Name: RoundRobinType}, nil
+	case LeastLoadedType:
+		return &LeastLoaded{Name: LeastLoadedType}, nil
+	case EpvmType:
+		return &Epvm{Name: EpvmType}, nil
+	default:
+		return nil, fmt.Errorf("unknown scheduler type %q", name)
+	}
+}
+
+// selectCandidateNodes filters out the nodes that can't take the task and
+// then keeps those that best satisfy its soft spread rules and its
+// preferences.
+func selectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node {
+	var candidates []*node.Node
+	for i, reason := range Reasons(t, nodes) {
+		if reason == "" {
+			candidates = append(candidates, nodes[i])
+		}
+	}
+
+	// Soft spread rules only rule out nodes while others remain.
+	s := newSpread(t, nodes)
+	var spread []*node.Node
+	for _, n := range candidates {
+		if s.check(n, true) == "" {
+			spread = append(spread, n)
+		}
+	}
+	if len(spread) > 0 {
+		candidates = spread
+	}
+	return preferred(t, candidates)
+}
+
+// Reasons returns, for each of nodes, why it can't take task t, such as
+// "insufficient memory", or "" if it can. As well as the checks of fits,
+// placing the task on the node must not break its hard spread rules.
+func Reasons(t task.Task, nodes []*node.Node) []string {
+	s := newSpread(t, nodes)
+	reasons := make([]string, len(nodes))
+	for i, n := range nodes {
+		reasons[i] = fits(t, n)
+		if reasons[i] == "" {
+			reasons[i] = s.check(n, false)
+		}
+	}
+	return reasons
+}
+
+// fits returns why node n can't take task t on its own account, or "" if
+// it can: the node must have enough memory, disk and CPU left unallocated
+// for the task, satisfy its constraints and run tasks that satisfy its hard
+// affinity rules.
+func fits(t task.Task, n *node.Node) string {
+	switch {
+	case !n.FitsMemory(t.Memory):
+		return "insufficient memory"
+	case !n.FitsDisk(t.Disk):
+		return "insufficient disk"
+	case !n.FitsCPU(t.CPU):
+		return "insufficient cpu"
+	}
+	for _, c := range t.Constraints {
+		if !c.Matches(n.Attribute(c.Key)) {
+			return fmt.Sprintf("didn't match %s", c)
+		}
+	}
+	for _, r := range t.Affinity {
+		if !r.Soft && countTasks(n, r.Selector) == 0 {
+			return fmt.Sprintf("didn't satisfy affinity %s", r.Selector)
+		}
+	}
+	for _, r := range t.AntiAffinity {
+		if !r.Soft && countTasks(n, r.Selector) > 0 {
+			return fmt.Sprintf("didn't satisfy anti-affinity %s", r.Selector)
+		}
+	}
+	return ""
+}
+
+// countTasks counts the tasks on n whose labels match selector.
+func countTasks(n *node.Node, selector task.Constraint) int {
+	count := 0
+	for _, labels := range n.TaskLabels {
+		if selector.MatchesLabels(labels) {
+			count++
+		}
+	}
+	return count
+}
+
+// preferred returns the nodes that best satisfy the task's preferences and
+// soft affinity rules. The schedulers then choose among these as usual, so
+// preferences decide which nodes are considered and the scheduler's own
+// scoring which of them is picked.
+func preferred(t task.Task, nodes []*node.Node) []*node.Node {
+	if len(nodes) == 0 {
+		return nodes
+	}
+
+	var best int
+	var result []*node.Node
+	for i, n := range nodes {
+		weight := preference(t, n)
+		switch {
+		case i == 0 || weight > best:
+			best = weight
+			result = []*node.Node{n}
+		case weight == best:
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// preference weighs node n for task t: the weight of each preference the
+// node satisfies and of each soft affinity rule it runs a matching task for,
+// less the weight of a soft anti-affinity rule for every matching task it
+// runs, so that tasks avoiding each other spread evenly.
+func preference(t task.Task, n *node.Node) int {
+	weight := 0
+	for _, p := range t.Preferences {
+		if p.Constraint.Matches(n.Attribute(p.Constraint.Key)) {
+			weight += p.Weight
+		}
+	}
+	for _, r := range t.Affinity {
+		if r.Soft && countTasks(n, r.Selector) > 0 {
+			weight += r.Weight
+		}
+	}
+	for _, r := range t.AntiAffinity {
+		if r.Soft {
+			weight -= r.Weight * countTasks(n, r.Selector)
+		}
+	}
+	return weight
+}
+
+// pickLowest returns the candidate with the lowest score, preferring the
+// earlier candidate on ties.
+func pickLowest(scores map[string]float64, candidates []*node.Node) *node.Node {
+	var best *node.Node
+	var lowest float64
+	for _, n := range candidates {
+		score, ok := scores[n.Name]
+		if !ok {
+			continue
+		}
+		if best == nil || score < lowest {
+			best = n
+			lowest = score
+		}
+	}
+	return best
 }
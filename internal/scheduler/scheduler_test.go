@@ -0,0 +1,527 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/c9s/goprocinfo/linux"
+	"github.com/elimt/go-orchestrator/internal/node"
+	"github.com/elimt/go-orchestrator/internal/stats"
+	"github.com/elimt/go-orchestrator/internal/task"
+)
+
+// pick scores nodes for task t with s and returns the name of the node it
+// picks, or "" if it picks none.
+func pick(s Scheduler, t task.Task, nodes []*node.Node) string {
+	n := s.Pick(s.Score(t, nodes), nodes)
+	if n == nil {
+		return ""
+	}
+	return n.Name
+}
+
+func TestNew(t *testing.T) {
+	for name, want := range map[string]string{
+		"":              RoundRobinType,
+		RoundRobinType:  RoundRobinType,
+		LeastLoadedType: LeastLoadedType,
+		EpvmType:        EpvmType,
+	} {
+		s, err := New(name)
+		if err != nil {
+			t.Errorf("New(%q): %v", name, err)
+			continue
+		}
+		var got string
+		switch s := s.(type) {
+		case *RoundRobin:
+			got = s.Name
+		case *LeastLoaded:
+			got = s.Name
+		case *Epvm:
+			got = s.Name
+		}
+		if got != want {
+			t.Errorf("New(%q) is %q, want %q", name, got, want)
+		}
+	}
+	if _, err := New("random"); err == nil {
+		t.Error(`New("random") succeeded, want an error`)
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	nodes := []*node.Node{{Name: "n1"}, {Name: "n2"}, {Name: "n3"}}
+	r := &RoundRobin{Name: RoundRobinType}
+	var got []string
+	for i := 0; i < 5; i++ {
+		got = append(got, pick(r, task.Task{}, nodes))
+	}
+	if want := "n2 n3 n1 n2 n3"; strings.Join(got, " ") != want {
+		t.Errorf("picked %q, want %q", strings.Join(got, " "), want)
+	}
+
+	if n := r.Pick(r.Score(task.Task{}, nil), nil); n != nil {
+		t.Errorf("picked %s from no nodes, want none", n.Name)
+	}
+}
+
+func TestLeastLoaded(t *testing.T) {
+	tests := []struct {
+		name   string
+		counts []int
+		want   string
+	}{
+		{name: "fewest tasks", counts: []int{3, 1, 2}, want: "n2"},
+		{name: "ties go to the earlier node", counts: []int{2, 1, 1}, want: "n2"},
+		{name: "idle node", counts: []int{0, 0}, want: "n1"},
+		{name: "no nodes", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var nodes []*node.Node
+			for i, c := range tt.counts {
+				nodes = append(nodes, &node.Node{Name: fmt.Sprintf("n%d", i+1), TaskCount: c})
+			}
+			if got := pick(&LeastLoaded{}, task.Task{}, nodes); got != tt.want {
+				t.Errorf("picked %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// sampled returns stats whose CPU was busy for busy of every 100 ticks
+// between two samples, after a long idle stretch.
+func sampled(busy uint64) stats.Stats {
+	return stats.Stats{
+		PrevCPUStats: &linux.CPUStat{User: 1000, Idle: 100000},
+		CPUStats:     &linux.CPUStat{User: 1000 + busy, Idle: 100000 + 100 - busy},
+	}
+}
+
+func TestEpvm(t *testing.T) {
+	const gib = 1024 * 1024
+	worker := func(name string) *node.Node {
+		return &node.Node{Name: name, Memory: gib, Cores: 4}
+	}
+	tests := []struct {
+		name  string
+		task  task.Task
+		setup func(n1, n2 *node.Node)
+		want  string
+	}{
+		{
+			name: "less memory allocated",
+			task: task.Task{Memory: 100 * 1024 * 1024},
+			setup: func(n1, n2 *node.Node) {
+				n1.MemoryAllocated = gib * 3 / 4
+				n2.MemoryAllocated = gib / 4
+			},
+			want: "n2",
+		},
+		{
+			name: "less memory in use",
+			task: task.Task{Memory: 100 * 1024 * 1024},
+			setup: func(n1, n2 *node.Node) {
+				n1.Stats.MemStats = &linux.MemInfo{MemTotal: gib, MemAvailable: gib / 4}
+				n2.Stats.MemStats = &linux.MemInfo{MemTotal: gib, MemAvailable: gib * 3 / 4}
+				// Allocations are ignored once the node reports its usage.
+				n2.MemoryAllocated = gib
+			},
+			want: "n2",
+		},
+		{
+			name: "fewer cores allocated",
+			task: task.Task{CPU: 1},
+			setup: func(n1, n2 *node.Node) {
+				n1.CPUAllocated = 1
+				n2.CPUAllocated = 3
+			},
+			want: "n1",
+		},
+		{
+			name: "less cpu used between samples",
+			task: task.Task{CPU: 1},
+			setup: func(n1, n2 *node.Node) {
+				n1.Stats = sampled(90)
+				n2.Stats = sampled(10)
+			},
+			want: "n2",
+		},
+		{
+			// n1 has been busier since boot, but n2 is busier now.
+			name: "recent cpu use outweighs use since boot",
+			task: task.Task{CPU: 1},
+			setup: func(n1, n2 *node.Node) {
+				n1.Stats = stats.Stats{
+					PrevCPUStats: &linux.CPUStat{User: 90000, Idle: 10000},
+					CPUStats:     &linux.CPUStat{User: 90000, Idle: 10100},
+				}
+				n2.Stats = sampled(100)
+			},
+			want: "n1",
+		},
+		{
+			name: "lower load average until two samples",
+			task: task.Task{CPU: 1},
+			setup: func(n1, n2 *node.Node) {
+				n1.Stats = stats.Stats{CPUStats: &linux.CPUStat{User: 10}, LoadStats: &linux.LoadAvg{Last1Min: 3.5}}
+				n2.Stats = stats.Stats{CPUStats: &linux.CPUStat{User: 90}, LoadStats: &linux.LoadAvg{Last1Min: 0.5}}
+			},
+			want: "n2",
+		},
+		{
+			name: "fewer tasks",
+			setup: func(n1, n2 *node.Node) {
+				n1.TaskCount = 3
+			},
+			want: "n2",
+		},
+		{
+			name:  "ties go to the earlier node",
+			setup: func(n1, n2 *node.Node) {},
+			want:  "n1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n1, n2 := worker("n1"), worker("n2")
+			tt.setup(n1, n2)
+			if got := pick(&Epvm{}, tt.task, []*node.Node{n1, n2}); got != tt.want {
+				t.Errorf("picked %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPickLowest(t *testing.T) {
+	nodes := []*node.Node{{Name: "n1"}, {Name: "n2"}, {Name: "n3"}}
+	tests := []struct {
+		name   string
+		scores map[string]float64
+		want   string
+	}{
+		{name: "lowest score", scores: map[string]float64{"n1": 2, "n2": 0.5, "n3": 1}, want: "n2"},
+		{name: "earliest of equal scores", scores: map[string]float64{"n1": 1, "n2": 0, "n3": 0}, want: "n2"},
+		{name: "unscored candidates are skipped", scores: map[string]float64{"n3": 5}, want: "n3"},
+		{name: "nothing scored", scores: map[string]float64{}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if n := pickLowest(tt.scores, nodes); n != nil {
+				got = n.Name
+			}
+			if got != tt.want {
+				t.Errorf("picked %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// names returns the names of nodes joined together.
+func names(nodes []*node.Node) string {
+	var ns []string
+	for _, n := range nodes {
+		ns = append(ns, n.Name)
+	}
+	return strings.Join(ns, " ")
+}
+
+func constraints(t *testing.T, ss ...string) []task.Constraint {
+	t.Helper()
+	var cs []task.Constraint
+	for _, s := range ss {
+		c, err := task.ParseConstraint(s)
+		if err != nil {
+			t.Fatalf("parsing %q: %v", s, err)
+		}
+		cs = append(cs, c)
+	}
+	return cs
+}
+
+// affinity returns hard affinity rules, or soft ones with weight 1, for
+// each of selectors.
+func affinity(t *testing.T, soft bool, selectors ...string) []task.AffinityRule {
+	t.Helper()
+	var rules []task.AffinityRule
+	for _, c := range constraints(t, selectors...) {
+		rules = append(rules, task.AffinityRule{Selector: c, Soft: soft, Weight: 1})
+	}
+	return rules
+}
+
+// constrainedNodes returns n1, a manager in zone a with an ssd running a
+// db task, n2, a worker in zone b running a web task, and n3, a small node
+// with neither role nor labels running nothing.
+func constrainedNodes() []*node.Node {
+	return []*node.Node{
+		{
+			Name: "n1", Role: "manager", Labels: map[string]string{"zone": "a", "disk": "ssd"},
+			TaskLabels: []map[string]string{{"app": "db"}},
+		},
+		{
+			Name: "n2", Role: "worker", Labels: map[string]string{"zone": "b"},
+			TaskLabels: []map[string]string{{"app": "web"}},
+		},
+		{Name: "n3", Memory: 1024, Disk: 1000, Cores: 1},
+	}
+}
+
+func TestFits(t *testing.T) {
+	tests := []struct {
+		name string
+		task func(t *testing.T) task.Task
+		want []string
+	}{
+		{
+			name: "no constraints",
+			task: func(t *testing.T) task.Task { return task.Task{} },
+			want: []string{"", "", ""},
+		},
+		{
+			name: "equal",
+			task: func(t *testing.T) task.Task {
+				return task.Task{Constraints: constraints(t, "node.labels.zone == a")}
+			},
+			want: []string{"", "didn't match node.labels.zone == a", "didn't match node.labels.zone == a"},
+		},
+		{
+			name: "not equal matches missing labels",
+			task: func(t *testing.T) task.Task {
+				return task.Task{Constraints: constraints(t, "node.labels.zone != a")}
+			},
+			want: []string{"didn't match node.labels.zone != a", "", ""},
+		},
+		{
+			name: "in",
+			task: func(t *testing.T) task.Task {
+				return task.Task{Constraints: constraints(t, "node.labels.zone in (a, b)")}
+			},
+			want: []string{"", "", "didn't match node.labels.zone in (a, b)"},
+		},
+		{
+			name: "exists",
+			task: func(t *testing.T) task.Task {
+				return task.Task{Constraints: constraints(t, "node.labels.disk exists")}
+			},
+			want: []string{"", "didn't match node.labels.disk exists", "didn't match node.labels.disk exists"},
+		},
+		{
+			name: "node name",
+			task: func(t *testing.T) task.Task {
+				return task.Task{Constraints: constraints(t, "node.name == n2")}
+			},
+			want: []string{"didn't match node.name == n2", "", "didn't match node.name == n2"},
+		},
+		{
+			name: "node role",
+			task: func(t *testing.T) task.Task {
+				return task.Task{Constraints: constraints(t, "node.role exists", "node.role != manager")}
+			},
+			want: []string{"didn't match node.role != manager", "", "didn't match node.role exists"},
+		},
+		{
+			name: "unknown attribute",
+			task: func(t *testing.T) task.Task {
+				return task.Task{Constraints: constraints(t, "node.zone == a")}
+			},
+			want: []string{"didn't match node.zone == a", "didn't match node.zone == a", "didn't match node.zone == a"},
+		},
+		{
+			name: "affinity",
+			task: func(t *testing.T) task.Task {
+				return task.Task{Affinity: affinity(t, false, "app == db")}
+			},
+			want: []string{"", "didn't satisfy affinity app == db", "didn't satisfy affinity app == db"},
+		},
+		{
+			name: "anti-affinity",
+			task: func(t *testing.T) task.Task {
+				return task.Task{AntiAffinity: affinity(t, false, "app exists")}
+			},
+			want: []string{"didn't satisfy anti-affinity app exists", "didn't satisfy anti-affinity app exists", ""},
+		},
+		{
+			name: "soft affinity doesn't filter",
+			task: func(t *testing.T) task.Task {
+				return task.Task{
+					Affinity:     affinity(t, true, "app == db"),
+					AntiAffinity: affinity(t, true, "app exists"),
+				}
+			},
+			want: []string{"", "", ""},
+		},
+		{
+			name: "memory",
+			task: func(t *testing.T) task.Task { return task.Task{Memory: 2 << 20} },
+			want: []string{"", "", "insufficient memory"},
+		},
+		{
+			name: "disk",
+			task: func(t *testing.T) task.Task { return task.Task{Disk: 2000} },
+			want: []string{"", "", "insufficient disk"},
+		},
+		{
+			name: "cpu",
+			task: func(t *testing.T) task.Task { return task.Task{CPU: 1.5} },
+			want: []string{"", "", "insufficient cpu"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Reasons(tt.task(t), constrainedNodes())
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("Reasons = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNoNodeMatches(t *testing.T) {
+	tk := task.Task{
+		Constraints: constraints(t, "node.labels.zone in (a, b)"),
+		Affinity:    affinity(t, false, "app == web"),
+		Memory:      1 << 20,
+	}
+	nodes := constrainedNodes()
+	nodes[1].Memory = 512
+	for _, name := range []string{RoundRobinType, LeastLoadedType, EpvmType} {
+		s, err := New(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		candidates := s.SelectCandidateNodes(tk, nodes)
+		if len(candidates) != 0 {
+			t.Errorf("%s: candidates are %s, want none", name, names(candidates))
+		}
+	}
+	want := []string{
+		"didn't satisfy affinity app == web",
+		"insufficient memory",
+		"didn't match node.labels.zone in (a, b)",
+	}
+	if got := Reasons(tk, nodes); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Reasons = %q, want %q", got, want)
+	}
+}
+
+func prefer(t *testing.T, s string, weight int) task.Preference {
+	t.Helper()
+	return task.Preference{Constraint: constraints(t, s)[0], Weight: weight}
+}
+
+func softRule(t *testing.T, selector string, weight int) task.AffinityRule {
+	t.Helper()
+	return task.AffinityRule{Selector: constraints(t, selector)[0], Soft: true, Weight: weight}
+}
+
+func TestPreferred(t *testing.T) {
+	tests := []struct {
+		name         string
+		constraints  []task.Constraint
+		preferences  []task.Preference
+		affinity     []task.AffinityRule
+		antiAffinity []task.AffinityRule
+		want         string
+	}{
+		{name: "no preferences", want: "n1 n2 n3"},
+		{
+			name:        "preference",
+			preferences: []task.Preference{prefer(t, "node.labels.zone == a", 1)},
+			want:        "n1",
+		},
+		{
+			name: "heavier preference",
+			preferences: []task.Preference{
+				prefer(t, "node.labels.zone == a", 1),
+				prefer(t, "node.role == worker", 5),
+			},
+			want: "n2",
+		},
+		{
+			name: "preferences add up",
+			preferences: []task.Preference{
+				prefer(t, "node.labels.zone == a", 3),
+				prefer(t, "node.labels.disk exists", 3),
+				prefer(t, "node.role == worker", 5),
+			},
+			want: "n1",
+		},
+		{
+			name: "equal weights",
+			preferences: []task.Preference{
+				prefer(t, "node.labels.zone == a", 2),
+				prefer(t, "node.labels.zone == b", 2),
+			},
+			want: "n1 n2",
+		},
+		{
+			name:     "soft affinity",
+			affinity: []task.AffinityRule{softRule(t, "app == web", 2)},
+			want:     "n2",
+		},
+		{
+			name:        "affinity outweighs preference",
+			preferences: []task.Preference{prefer(t, "node.labels.zone == a", 1)},
+			affinity:    []task.AffinityRule{softRule(t, "app == web", 3)},
+			want:        "n2",
+		},
+		{
+			name:         "soft anti-affinity",
+			preferences:  []task.Preference{prefer(t, "node.labels.zone == b", 1)},
+			antiAffinity: []task.AffinityRule{softRule(t, "app exists", 2)},
+			want:         "n3",
+		},
+		{
+			name:         "preference outweighs anti-affinity",
+			preferences:  []task.Preference{prefer(t, "node.labels.zone == b", 2)},
+			antiAffinity: []task.AffinityRule{softRule(t, "app exists", 1)},
+			want:         "n2",
+		},
+		{
+			name:        "unsatisfiable preference",
+			preferences: []task.Preference{prefer(t, "node.labels.zone == c", 5)},
+			want:        "n1 n2 n3",
+		},
+		{
+			name:        "unsatisfiable preference among constrained nodes",
+			constraints: constraints(t, "node.role exists"),
+			preferences: []task.Preference{prefer(t, "node.name == n3", 5)},
+			want:        "n1 n2",
+		},
+		{
+			name:     "unsatisfiable affinity",
+			affinity: []task.AffinityRule{softRule(t, "app == cache", 5)},
+			want:     "n1 n2 n3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tk := task.Task{
+				Constraints:  tt.constraints,
+				Preferences:  tt.preferences,
+				Affinity:     tt.affinity,
+				AntiAffinity: tt.antiAffinity,
+			}
+			nodes := constrainedNodes()
+			candidates := selectCandidateNodes(tk, nodes)
+			if got := names(candidates); got != tt.want {
+				t.Fatalf("candidates are %q, want %q", got, tt.want)
+			}
+			// Every scheduler places the task on one of the preferred nodes.
+			for _, name := range []string{RoundRobinType, LeastLoadedType, EpvmType} {
+				s, err := New(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := pick(s, tk, s.SelectCandidateNodes(tk, nodes))
+				if !strings.Contains(" "+tt.want+" ", " "+got+" ") {
+					t.Errorf("%s picked %q, want one of %q", name, got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package scheduler
+
+import (
+	"fmt"
+
+	"github.com/elimt/go-orchestrator/internal/node"
+	"github.com/elimt/go-orchestrator/internal/task"
+)
+
+// spread holds, for each of a task's topology spread rules, how many
+// matching tasks run in each domain: the nodes sharing a value of the
+// rule's label.
+type spread struct {
+	t      task.Task
+	counts []map[string]int
+}
+
+// newSpread counts the tasks matching t's spread rules across nodes. Only
+// nodes that satisfy t's constraints and have the rule's label make up its
+// domains, since the task could not be placed on the others anyway.
+func newSpread(t task.Task, nodes []*node.Node) *spread {
+	s := &spread{t: t, counts: make([]map[string]int, len(t.TopologySpread))}
+	for i, r := range t.TopologySpread {
+		s.counts[i] = make(map[string]int)
+		for _, n := range nodes {
+			domain, ok := n.Labels[r.Key]
+			if !ok || !satisfiesConstraints(t, n) {
+				continue
+			}
+			s.counts[i][domain] += countTasks(n, r.Selector)
+		}
+	}
+	return s
+}
+
+// check returns why placing the task on n would break one of its spread
+// rules, or "" if it wouldn't. Soft rules are only checked when soft is
+// true.
+func (s *spread) check(n *node.Node, soft bool) string {
+	for i, r := range s.t.TopologySpread {
+		if r.Soft != soft {
+			continue
+		}
+		domain, ok := n.Labels[r.Key]
+		if !ok {
+			return fmt.Sprintf("had no %s label", r.Key)
+		}
+		if s.skew(i, domain) > r.MaxSkew {
+			return fmt.Sprintf("would exceed a skew of %d across %s", r.MaxSkew, r.Key)
+		}
+	}
+	return ""
+}
+
+// skew is the difference between the number of matching tasks in domain,
+// once the task is placed there, and in the domain with the fewest at that
+// point, which may be domain itself.
+func (s *spread) skew(rule int, domain string) int {
+	counts := s.counts[rule]
+	after := counts[domain]
+	if s.t.TopologySpread[rule].Selector.MatchesLabels(s.t.Labels) {
+		after++
+	}
+	least := after
+	for d, c := range counts {
+		if d != domain && c < least {
+			least = c
+		}
+	}
+	return after - least
+}
+
+func satisfiesConstraints(t task.Task, n *node.Node) bool {
+	for _, c := range t.Constraints {
+		if !c.Matches(n.Attribute(c.Key)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,150 @@
+package scheduler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/elimt/go-orchestrator/internal/node"
+	"github.com/elimt/go-orchestrator/internal/task"
+)
+
+// zoneNode returns a node in zone running tasks tasks labelled app=web.
+func zoneNode(name string, zone string, tasks int) *node.Node {
+	n := &node.Node{Name: name, Labels: map[string]string{}}
+	if zone != "" {
+		n.Labels["zone"] = zone
+	}
+	for i := 0; i < tasks; i++ {
+		n.TaskLabels = append(n.TaskLabels, map[string]string{"app": "web"})
+	}
+	return n
+}
+
+// spreadTask returns a task labelled app=web spread across zones with the
+// given skew.
+func spreadTask(t *testing.T, maxSkew int, soft bool) task.Task {
+	t.Helper()
+	selector, err := task.ParseConstraint("app == web")
+	if err != nil {
+		t.Fatalf("parsing selector: %v", err)
+	}
+	return task.Task{
+		Labels:         map[string]string{"app": "web"},
+		TopologySpread: []task.SpreadRule{{Key: "zone", MaxSkew: maxSkew, Selector: selector, Soft: soft}},
+	}
+}
+
+func TestSpreadHard(t *testing.T) {
+	const exceeded = "would exceed a skew of 1 across zone"
+	tests := []struct {
+		name    string
+		maxSkew int
+		nodes   []*node.Node
+		setup   func(t *task.Task)
+		want    []string
+	}{
+		{
+			name:    "even domains",
+			maxSkew: 1,
+			nodes:   []*node.Node{zoneNode("n1", "a", 1), zoneNode("n2", "b", 1)},
+			want:    []string{"", ""},
+		},
+		{
+			name:    "fuller domain",
+			maxSkew: 1,
+			nodes:   []*node.Node{zoneNode("n1", "a", 1), zoneNode("n2", "b", 0)},
+			want:    []string{exceeded, ""},
+		},
+		{
+			name:    "domains of several nodes",
+			maxSkew: 1,
+			nodes:   []*node.Node{zoneNode("n1", "a", 1), zoneNode("n2", "a", 1), zoneNode("n3", "b", 1)},
+			want:    []string{exceeded, exceeded, ""},
+		},
+		{
+			name:    "larger skew",
+			maxSkew: 2,
+			nodes:   []*node.Node{zoneNode("n1", "a", 2), zoneNode("n2", "b", 0)},
+			want:    []string{"would exceed a skew of 2 across zone", ""},
+		},
+		{
+			// Placing the task in the emptiest domain evens it with the rest.
+			name:    "no skew into the emptiest domain",
+			maxSkew: 0,
+			nodes:   []*node.Node{zoneNode("n1", "a", 0), zoneNode("n2", "b", 1)},
+			want:    []string{"", "would exceed a skew of 0 across zone"},
+		},
+		{
+			name:    "node without the label",
+			maxSkew: 1,
+			nodes:   []*node.Node{zoneNode("n1", "a", 0), zoneNode("n2", "", 0)},
+			want:    []string{"", "had no zone label"},
+		},
+		{
+			name:    "task outside the selector",
+			maxSkew: 1,
+			nodes:   []*node.Node{zoneNode("n1", "a", 2), zoneNode("n2", "b", 1)},
+			setup:   func(t *task.Task) { t.Labels = map[string]string{"app": "db"} },
+			want:    []string{"", ""},
+		},
+		{
+			name:    "domains the task can't use don't count",
+			maxSkew: 1,
+			nodes:   []*node.Node{zoneNode("n1", "a", 1), zoneNode("n2", "b", 1), zoneNode("n3", "c", 0)},
+			setup: func(t *task.Task) {
+				c, _ := task.ParseConstraint("node.labels.zone != c")
+				t.Constraints = []task.Constraint{c}
+			},
+			want: []string{"", "", "didn't match node.labels.zone != c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tk := spreadTask(t, tt.maxSkew, false)
+			if tt.setup != nil {
+				tt.setup(&tk)
+			}
+			if got := Reasons(tk, tt.nodes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Reasons = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpreadSoft(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes []*node.Node
+		want  string
+	}{
+		{
+			name:  "emptier domain preferred",
+			nodes: []*node.Node{zoneNode("n1", "a", 1), zoneNode("n2", "b", 0), zoneNode("n3", "b", 0)},
+			want:  "n2 n3",
+		},
+		{
+			name:  "even domains",
+			nodes: []*node.Node{zoneNode("n1", "a", 1), zoneNode("n2", "b", 1)},
+			want:  "n1 n2",
+		},
+		{
+			// The only node with room breaks the rule, so it is used anyway.
+			name: "placed when every node breaks it",
+			nodes: func() []*node.Node {
+				full := zoneNode("n2", "b", 0)
+				full.Cores, full.CPUAllocated = 1, 1
+				return []*node.Node{zoneNode("n1", "a", 1), full}
+			}(),
+			want: "n1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tk := spreadTask(t, 1, true)
+			tk.CPU = 1
+			if got := names(selectCandidateNodes(tk, tt.nodes)); got != tt.want {
+				t.Errorf("candidates %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,551 @@
+// Package spec defines the declarative job and service specifications users
+// submit to the manager, in YAML or JSON, and converts them into tasks.
+package spec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/elimt/go-orchestrator/internal/task"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// Version is the spec format version this package understands.
+const Version = "v1"
+
+// Spec describes a job: a named group of tasks submitted together. A spec
+// with a Schedule describes a cron job, which submits the job each time the
+// schedule fires. Tenant is the team the job's tasks are queued for.
+type Spec struct {
+	Version           string     `json:"version"`
+	Name              string     `json:"name"`
+	Tenant            string     `json:"tenant,omitempty"`
+	Schedule          string     `json:"schedule,omitempty"`
+	ConcurrencyPolicy string     `json:"concurrencyPolicy,omitempty"`
+	Tasks             []TaskSpec `json:"tasks"`
+}
+
+// ServiceSpec describes a service: Replicas copies of a task kept running.
+type ServiceSpec struct {
+	Version  string      `json:"version"`
+	Name     string      `json:"name"`
+	Tenant   string      `json:"tenant,omitempty"`
+	Replicas int         `json:"replicas"`
+	Task     TaskSpec    `json:"task"`
+	Update   *UpdateSpec `json:"update,omitempty"`
+}
+
+// UpdateSpec is the rolling update strategy of a service. Unset fields take
+// the defaults of task.DefaultUpdateConfig.
+type UpdateSpec struct {
+	MaxSurge       *int     `json:"maxSurge,omitempty"`
+	MaxUnavailable *int     `json:"maxUnavailable,omitempty"`
+	Delay          Duration `json:"delay,omitempty"`
+	Monitor        Duration `json:"monitor,omitempty"`
+	Timeout        Duration `json:"timeout,omitempty"`
+	FailureAction  string   `json:"failureAction,omitempty"`
+}
+
+type TaskSpec struct {
+	Name             string            `json:"name"`
+	Image            string            `json:"image"`
+	Cmd              []string          `json:"cmd,omitempty"`
+	Env              map[string]string `json:"env,omitempty"`
+	Resources        Resources         `json:"resources,omitempty"`
+	Ports            []string          `json:"ports,omitempty"`
+	RestartPolicy    string            `json:"restartPolicy,omitempty"`
+	MaxRestarts      int               `json:"maxRestarts,omitempty"`
+	Retries          int               `json:"retries,omitempty"`
+	PriorityClass    string            `json:"priorityClass,omitempty"`
+	PreemptionPolicy string            `json:"preemptionPolicy,omitempty"`
+	DependsOn        []DependencySpec  `json:"dependsOn,omitempty"`
+	HealthCheck      *HealthCheckSpec  `json:"healthCheck,omitempty"`
+	Constraints      []string          `json:"constraints,omitempty"`
+	Preferences      []PreferenceSpec  `json:"preferences,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	Affinity         []AffinitySpec    `json:"affinity,omitempty"`
+	AntiAffinity     []AffinitySpec    `json:"antiAffinity,omitempty"`
+	TopologySpread   []SpreadSpec      `json:"topologySpread,omitempty"`
+}
+
+// DependencySpec names another task of the job and the condition it must
+// reach before this task is scheduled. It may be written as just the task
+// name, which waits for the task to complete.
+type DependencySpec struct {
+	Task      string `json:"task"`
+	Condition string `json:"condition,omitempty"`
+}
+
+func (d *DependencySpec) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*d = DependencySpec{Task: name}
+		return nil
+	}
+
+	// The alias has no UnmarshalJSON of its own, and unknown fields are
+	// rejected here as they are everywhere else.
+	type dependency DependencySpec
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode((*dependency)(d))
+}
+
+// PreferenceSpec is a constraint the task would rather be placed by, with
+// the weight it carries against the task's other preferences. It may be
+// written as just the constraint, with a weight of 1.
+type PreferenceSpec struct {
+	Constraint string `json:"constraint"`
+	Weight     int    `json:"weight,omitempty"`
+}
+
+func (p *PreferenceSpec) UnmarshalJSON(data []byte) error {
+	var constraint string
+	if err := json.Unmarshal(data, &constraint); err == nil {
+		*p = PreferenceSpec{Constraint: constraint}
+		return nil
+	}
+
+	type preference PreferenceSpec
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode((*preference)(p))
+}
+
+// AffinitySpec selects other tasks by their labels, with a constraint such
+// as "app == web". A hard rule, the default, must hold for the task to be
+// placed on a node, while a soft rule only weighs nodes. It may be written
+// as just the selector, for a hard rule.
+type AffinitySpec struct {
+	Selector string `json:"selector"`
+	Soft     bool   `json:"soft,omitempty"`
+	Weight   int    `json:"weight,omitempty"`
+}
+
+func (a *AffinitySpec) UnmarshalJSON(data []byte) error {
+	var selector string
+	if err := json.Unmarshal(data, &selector); err == nil {
+		*a = AffinitySpec{Selector: selector}
+		return nil
+	}
+
+	type affinity AffinitySpec
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode((*affinity)(a))
+}
+
+// SpreadSpec spreads the tasks matching Selector across the values of the
+// node label Key with at most MaxSkew, 1 unless given, between the value
+// with the most and the value with the fewest.
+type SpreadSpec struct {
+	Key      string `json:"key"`
+	MaxSkew  int    `json:"maxSkew,omitempty"`
+	Selector string `json:"selector"`
+	Soft     bool   `json:"soft,omitempty"`
+}
+
+// Resources are written as a number of bytes or with a unit, such as 512Mi
+// or 1G. CPU is the number of cores the task needs, such as 0.5 or 500m,
+// and CPULimit the most it may use.
+type Resources struct {
+	Memory   Quantity `json:"memory,omitempty"`
+	Disk     Quantity `json:"disk,omitempty"`
+	CPU      Quantity `json:"cpu,omitempty"`
+	CPULimit Quantity `json:"cpuLimit,omitempty"`
+}
+
+type HealthCheckSpec struct {
+	Type     string   `json:"type"`
+	Port     int      `json:"port,omitempty"`
+	Path     string   `json:"path,omitempty"`
+	Command  []string `json:"command,omitempty"`
+	Interval Duration `json:"interval,omitempty"`
+	Timeout  Duration `json:"timeout,omitempty"`
+	Retries  int      `json:"retries,omitempty"`
+}
+
+// Quantity is a size or a number of cores as written in the spec. It is
+// checked by Validate.
+type Quantity string
+
+// Duration is a duration as written in the spec, such as 10s. It is checked
+// by Validate.
+type Duration string
+
+func (q *Quantity) UnmarshalJSON(data []byte) error {
+	s, err := scalar(data)
+	*q = Quantity(s)
+	return err
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	s, err := scalar(data)
+	*d = Duration(s)
+	return err
+}
+
+// scalar returns a JSON string or number as text, so that malformed values
+// are reported by Validate with the field they belong to.
+func scalar(data []byte) (string, error) {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return s, nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return "", fmt.Errorf("expected a string or number, got %s", data)
+	}
+	return n.String(), nil
+}
+
+// Parse reads a job spec written in YAML or JSON. Unknown fields are
+// rejected so that misspelt settings are not silently ignored.
+func Parse(data []byte) (*Spec, error) {
+	s := Spec{}
+	if err := decode(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ParseService reads a service spec written in YAML or JSON.
+func ParseService(data []byte) (*ServiceSpec, error) {
+	s := ServiceSpec{}
+	if err := decode(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func decode(data []byte, v interface{}) error {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("error parsing spec: %w", err)
+	}
+	if doc == nil {
+		return fmt.Errorf("error parsing spec: spec is empty")
+	}
+
+	// YAML is decoded generically and re-encoded as JSON so that both
+	// formats go through the same strict decoder.
+	raw, err := json.Marshal(jsonCompatible(doc))
+	if err != nil {
+		return fmt.Errorf("error parsing spec: %w", err)
+	}
+
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.DisallowUnknownFields()
+	if err := d.Decode(v); err != nil {
+		return fmt.Errorf("error parsing spec: %w", err)
+	}
+	return nil
+}
+
+// jsonCompatible converts the maps with non-string keys that YAML allows
+// into maps that encoding/json can encode.
+func jsonCompatible(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = jsonCompatible(e)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = jsonCompatible(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = jsonCompatible(e)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// Build converts a valid spec into the tasks it describes, each ready to be
+// scheduled. Task names are prefixed with the job name.
+func (s *Spec) Build() ([]task.Task, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	if s.Schedule != "" {
+		return nil, ValidationErrors{{Field: "schedule", Message: "is only used by cron jobs"}}
+	}
+	return s.build(), nil
+}
+
+// BuildCronJob converts a valid spec with a schedule into a cron job. Its
+// tasks are the templates each run is started from.
+func (s *Spec) BuildCronJob() (*task.CronJob, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	if s.Schedule == "" {
+		return nil, ValidationErrors{{Field: "schedule", Message: "is required for cron jobs"}}
+	}
+
+	policy := s.ConcurrencyPolicy
+	if policy == "" {
+		policy = task.ConcurrencyAllow
+	}
+	return &task.CronJob{
+		Name:              s.Name,
+		Schedule:          s.Schedule,
+		ConcurrencyPolicy: policy,
+		Tasks:             s.build(),
+	}, nil
+}
+
+func (s *Spec) build() []task.Task {
+	tasks := make([]task.Task, 0, len(s.Tasks))
+	for _, ts := range s.Tasks {
+		t := ts.build(fmt.Sprintf("%s-%s", s.Name, ts.Name))
+		t.ID = uuid.New()
+		t.Tenant = tenant(s.Tenant)
+		tasks = append(tasks, t)
+	}
+	return tasks
+}
+
+// Build converts a valid service spec into a service, with the template its
+// replicas are started from and its update strategy.
+func (s *ServiceSpec) Build() (*task.Service, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	svc := task.Service{
+		Name:     s.Name,
+		Replicas: s.Replicas,
+		Template: s.Task.build(s.Name),
+		Update:   task.DefaultUpdateConfig(),
+	}
+	svc.Template.Tenant = tenant(s.Tenant)
+	if u := s.Update; u != nil {
+		if u.MaxSurge != nil {
+			svc.Update.MaxSurge = *u.MaxSurge
+		}
+		if u.MaxUnavailable != nil {
+			svc.Update.MaxUnavailable = *u.MaxUnavailable
+		}
+		svc.Update.Delay, _ = u.Delay.Duration()
+		if u.Monitor != "" {
+			svc.Update.Monitor, _ = u.Monitor.Duration()
+		}
+		if timeout, _ := u.Timeout.Duration(); timeout > 0 {
+			svc.Update.Timeout = timeout
+		}
+		if u.FailureAction != "" {
+			svc.Update.FailureAction = u.FailureAction
+		}
+	}
+	return &svc, nil
+}
+
+// build converts a validated task spec into a task named name.
+func (ts TaskSpec) build(name string) task.Task {
+	t := task.Task{
+		Name:          name,
+		State:         task.Scheduled,
+		Image:         ts.Image,
+		Cmd:           ts.Cmd,
+		Env:           envList(ts.Env),
+		RestartPolicy: ts.RestartPolicy,
+		MaxRestarts:   ts.MaxRestarts,
+		MaxRetries:    ts.Retries,
+	}
+	_ = t.SetPriorityClass(ts.PriorityClass)
+	t.PreemptionPolicy = ts.PreemptionPolicy
+	for _, d := range ts.DependsOn {
+		condition := d.Condition
+		if condition == "" {
+			condition = task.DependencyCompleted
+		}
+		t.DependsOn = append(t.DependsOn, task.Dependency{Task: d.Task, Condition: condition})
+	}
+	t.Memory, _ = ts.Resources.Memory.Bytes()
+	t.Disk, _ = ts.Resources.Disk.Bytes()
+	t.CPU, _ = ts.Resources.CPU.Cores()
+	t.CPULimit, _ = ts.Resources.CPULimit.Cores()
+	// A task with only a limit is reserved what it may use.
+	if t.CPU == 0 {
+		t.CPU = t.CPULimit
+	}
+
+	if len(ts.Ports) > 0 {
+		t.ExposedPorts = nat.PortSet{}
+		for _, p := range ts.Ports {
+			port, _ := parsePort(p)
+			t.ExposedPorts[port] = struct{}{}
+		}
+	}
+	if hc := ts.HealthCheck; hc != nil {
+		t.HealthCheck = &task.HealthCheck{
+			Type:    hc.Type,
+			Port:    hc.Port,
+			Path:    hc.Path,
+			Command: hc.Command,
+			Retries: hc.Retries,
+		}
+		t.HealthCheck.Interval, _ = hc.Interval.Duration()
+		t.HealthCheck.Timeout, _ = hc.Timeout.Duration()
+	}
+	ts.buildPlacement(&t)
+	return t
+}
+
+// buildPlacement sets the rules that decide where the task is placed.
+func (ts TaskSpec) buildPlacement(t *task.Task) {
+	for _, c := range ts.Constraints {
+		parsed, _ := task.ParseConstraint(c)
+		t.Constraints = append(t.Constraints, parsed)
+	}
+	for _, p := range ts.Preferences {
+		parsed, _ := task.ParseConstraint(p.Constraint)
+		weight := p.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		t.Preferences = append(t.Preferences, task.Preference{Constraint: parsed, Weight: weight})
+	}
+	if len(ts.Labels) > 0 {
+		t.Labels = ts.Labels
+	}
+	t.Affinity = affinityRules(ts.Affinity)
+	t.AntiAffinity = affinityRules(ts.AntiAffinity)
+	for _, sp := range ts.TopologySpread {
+		selector, _ := task.ParseConstraint(sp.Selector)
+		r := task.SpreadRule{Key: sp.Key, MaxSkew: sp.MaxSkew, Selector: selector, Soft: sp.Soft}
+		if r.MaxSkew == 0 {
+			r.MaxSkew = 1
+		}
+		t.TopologySpread = append(t.TopologySpread, r)
+	}
+}
+
+func tenant(name string) string {
+	if name == "" {
+		return task.DefaultTenant
+	}
+	return name
+}
+
+func affinityRules(specs []AffinitySpec) []task.AffinityRule {
+	var rules []task.AffinityRule
+	for _, a := range specs {
+		selector, _ := task.ParseConstraint(a.Selector)
+		r := task.AffinityRule{Selector: selector, Soft: a.Soft}
+		if a.Soft {
+			r.Weight = a.Weight
+			if r.Weight == 0 {
+				r.Weight = 1
+			}
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+func envList(env map[string]string) []string {
+	if len(env) == 0 {
+		return nil
+	}
+	list := make([]string, 0, len(env))
+	for k, v := range env {
+		list = append(list, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(list)
+	return list
+}
+
+// parsePort parses a port such as 80 or 53/udp. The protocol defaults to
+// tcp.
+func parsePort(p string) (nat.Port, error) {
+	proto, port := nat.SplitProtoPort(p)
+	if proto != "tcp" && proto != "udp" && proto != "sctp" {
+		return "", fmt.Errorf("unknown protocol %q", proto)
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("%q is not a port between 1 and 65535", port)
+	}
+	return nat.NewPort(proto, port)
+}
+
+var units = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40},
+	{"k", 1e3}, {"K", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12},
+}
+
+// Bytes returns the quantity in bytes. An empty quantity is 0.
+func (q Quantity) Bytes() (int64, error) {
+	s := strings.TrimSpace(string(q))
+	if s == "" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSuffix(s, u.suffix)
+			multiplier = u.bytes
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a size such as 512Mi or 1G", string(q))
+	}
+	return n * multiplier, nil
+}
+
+// Cores returns the quantity as a number of CPU cores. It is written as a
+// number of cores, such as 2 or 0.5, or in thousandths with an m suffix,
+// such as 500m. An empty quantity is 0.
+func (q Quantity) Cores() (float64, error) {
+	s := strings.TrimSpace(string(q))
+	if s == "" {
+		return 0, nil
+	}
+
+	divisor := 1.0
+	if strings.HasSuffix(s, "m") {
+		s = strings.TrimSuffix(s, "m")
+		divisor = 1000
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+		return 0, fmt.Errorf("%q is not a number of cores such as 2, 0.5 or 500m", string(q))
+	}
+	return n / divisor, nil
+}
+
+// Duration returns the parsed duration. An empty duration is 0, meaning the
+// default.
+func (d Duration) Duration() (time.Duration, error) {
+	if d == "" {
+		return 0, nil
+	}
+	parsed, err := time.ParseDuration(string(d))
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("%q is not a duration such as 10s or 1m", string(d))
+	}
+	return parsed, nil
+}
@@ -0,0 +1,416 @@
+package spec
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/elimt/go-orchestrator/internal/cron"
+	"github.com/elimt/go-orchestrator/internal/task"
+)
+
+// FieldError is a problem with one field of a spec. Field is the path to
+// it, such as tasks[0].image.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidationErrors lists every problem found in a spec.
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Error())
+	}
+	return fmt.Sprintf("invalid spec: %s", strings.Join(msgs, "; "))
+}
+
+// names are used in container names, so they are limited to the characters
+// container engines accept there.
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+var validEnvKey = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+var restartPolicies = map[string]bool{
+	"":               true,
+	"no":             true,
+	"always":         true,
+	"unless-stopped": true,
+	"on-failure":     true,
+}
+
+// Validate checks the spec and returns ValidationErrors describing every
+// problem found, or nil if the spec is valid.
+func (s *Spec) Validate() error {
+	var errs ValidationErrors
+	add := func(field string, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	validateHeader(s.Version, s.Name, add)
+	validateTenant(s.Tenant, add)
+
+	if s.Schedule != "" {
+		if _, err := cron.Parse(s.Schedule); err != nil {
+			add("schedule", "%v", err)
+		}
+	}
+	switch s.ConcurrencyPolicy {
+	case "", task.ConcurrencyAllow, task.ConcurrencyForbid, task.ConcurrencyReplace:
+		if s.ConcurrencyPolicy != "" && s.Schedule == "" {
+			add("concurrencyPolicy", "is only used with a schedule")
+		}
+	default:
+		add("concurrencyPolicy", "%q must be one of allow, forbid or replace", s.ConcurrencyPolicy)
+	}
+
+	if len(s.Tasks) == 0 {
+		add("tasks", "at least one task is required")
+	}
+
+	seen := make(map[string]int)
+	for i, ts := range s.Tasks {
+		f := fmt.Sprintf("tasks[%d]", i)
+
+		if ts.Name == "" {
+			add(f+".name", "is required")
+		} else if !validName.MatchString(ts.Name) {
+			add(f+".name", "%q may only contain letters, digits, '_', '.' and '-'", ts.Name)
+		} else if j, ok := seen[ts.Name]; ok {
+			add(f+".name", "%q is already used by tasks[%d]", ts.Name, j)
+		} else {
+			seen[ts.Name] = i
+		}
+
+		validateTask(f, ts, add)
+	}
+	validateDependencies(s.Tasks, seen, add)
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Validate checks the service spec and returns ValidationErrors describing
+// every problem found, or nil if the spec is valid.
+func (s *ServiceSpec) Validate() error {
+	var errs ValidationErrors
+	add := func(field string, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	validateHeader(s.Version, s.Name, add)
+	validateTenant(s.Tenant, add)
+	if s.Replicas < 0 {
+		add("replicas", "must not be negative")
+	}
+	validateTask("task", s.Task, add)
+	if s.Task.Retries != 0 {
+		add("task.retries", "is only used by job tasks, services replace failed tasks")
+	}
+	if len(s.Task.DependsOn) > 0 {
+		add("task.dependsOn", "is only used by job tasks")
+	}
+	if s.Update != nil {
+		validateUpdate("update", s.Update, add)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateHeader(version string, name string, add func(string, string, ...interface{})) {
+	switch version {
+	case Version:
+	case "":
+		add("version", "is required, the current version is %s", Version)
+	default:
+		add("version", "unsupported version %q, the current version is %s", version, Version)
+	}
+
+	if name == "" {
+		add("name", "is required")
+	} else if !validName.MatchString(name) {
+		add("name", "%q may only contain letters, digits, '_', '.' and '-'", name)
+	}
+}
+
+func validateTenant(tenant string, add func(string, string, ...interface{})) {
+	if tenant != "" && !validName.MatchString(tenant) {
+		add("tenant", "%q may only contain letters, digits, '_', '.' and '-'", tenant)
+	}
+}
+
+// validateTask checks the settings of a task spec other than its name.
+func validateTask(f string, ts TaskSpec, add func(string, string, ...interface{})) {
+	if strings.TrimSpace(ts.Image) == "" {
+		add(f+".image", "is required")
+	}
+
+	for k := range ts.Env {
+		if !validEnvKey.MatchString(k) {
+			add(fmt.Sprintf("%s.env.%s", f, k), "is not a valid environment variable name")
+		}
+	}
+
+	validateResources(f+".resources", ts.Resources, add)
+
+	for j, p := range ts.Ports {
+		if _, err := parsePort(p); err != nil {
+			add(fmt.Sprintf("%s.ports[%d]", f, j), "%v", err)
+		}
+	}
+
+	if !restartPolicies[ts.RestartPolicy] {
+		add(f+".restartPolicy", "%q must be one of no, always, unless-stopped or on-failure", ts.RestartPolicy)
+	}
+	if ts.MaxRestarts < 0 {
+		add(f+".maxRestarts", "must not be negative")
+	}
+	if ts.Retries < 0 {
+		add(f+".retries", "must not be negative")
+	}
+	if ts.PriorityClass != "" {
+		if _, err := task.PriorityOf(ts.PriorityClass); err != nil {
+			add(f+".priorityClass", "%q must be one of %s", ts.PriorityClass, task.PriorityClassNames())
+		}
+	}
+	if err := task.ValidatePreemptionPolicy(ts.PreemptionPolicy); err != nil {
+		add(f+".preemptionPolicy", "%q must be preempt or never", ts.PreemptionPolicy)
+	}
+
+	if ts.HealthCheck != nil {
+		validateHealthCheck(f+".healthCheck", ts.HealthCheck, add)
+	}
+
+	validatePlacement(f, ts, add)
+}
+
+func validateResources(f string, r Resources, add func(string, string, ...interface{})) {
+	if _, err := r.Memory.Bytes(); err != nil {
+		add(f+".memory", "%v", err)
+	}
+	if _, err := r.Disk.Bytes(); err != nil {
+		add(f+".disk", "%v", err)
+	}
+	cpu, err := r.CPU.Cores()
+	if err != nil {
+		add(f+".cpu", "%v", err)
+	}
+	cpuLimit, err := r.CPULimit.Cores()
+	if err != nil {
+		add(f+".cpuLimit", "%v", err)
+	}
+	if cpuLimit > 0 && cpu > cpuLimit {
+		add(f+".cpuLimit", "must not be less than resources.cpu")
+	}
+}
+
+// validatePlacement checks the rules that decide where a task is placed.
+func validatePlacement(f string, ts TaskSpec, add func(string, string, ...interface{})) {
+	for j, c := range ts.Constraints {
+		if _, err := task.ParseConstraint(c); err != nil {
+			add(fmt.Sprintf("%s.constraints[%d]", f, j), "%v", err)
+		}
+	}
+	for j, p := range ts.Preferences {
+		pf := fmt.Sprintf("%s.preferences[%d]", f, j)
+		if _, err := task.ParseConstraint(p.Constraint); err != nil {
+			add(pf+".constraint", "%v", err)
+		}
+		if p.Weight < 0 || p.Weight > 100 {
+			add(pf+".weight", "must be between 1 and 100")
+		}
+	}
+
+	for k := range ts.Labels {
+		if !task.ValidLabelKey(k) {
+			add(fmt.Sprintf("%s.labels.%s", f, k), "is not a valid label key")
+		}
+	}
+	validateAffinity(f+".affinity", ts.Affinity, add)
+	validateAffinity(f+".antiAffinity", ts.AntiAffinity, add)
+	for j, sp := range ts.TopologySpread {
+		sf := fmt.Sprintf("%s.topologySpread[%d]", f, j)
+		if sp.Key == "" {
+			add(sf+".key", "is required, the node label to spread across")
+		} else if !task.ValidLabelKey(sp.Key) {
+			add(sf+".key", "%q is not a valid label key", sp.Key)
+		}
+		if sp.MaxSkew < 0 {
+			add(sf+".maxSkew", "must be at least 1")
+		}
+		if _, err := task.ParseConstraint(sp.Selector); err != nil {
+			add(sf+".selector", "%v", err)
+		}
+	}
+}
+
+// validateDependencies checks that the tasks' dependencies name other tasks
+// of the job, with a condition they can reach, and that no task depends on
+// itself through a chain of others. index maps task names to their position.
+func validateDependencies(tasks []TaskSpec, index map[string]int, add func(string, string, ...interface{})) {
+	for i, ts := range tasks {
+		for j, d := range ts.DependsOn {
+			f := fmt.Sprintf("tasks[%d].dependsOn[%d]", i, j)
+
+			k, ok := index[d.Task]
+			switch {
+			case d.Task == "":
+				add(f+".task", "is required")
+			case d.Task == ts.Name:
+				add(f+".task", "a task can't depend on itself")
+			case !ok:
+				add(f+".task", "%q is not a task of this job", d.Task)
+			}
+
+			switch d.Condition {
+			case "", task.DependencyCompleted, task.DependencyStarted:
+			case task.DependencyHealthy:
+				if ok && tasks[k].HealthCheck == nil {
+					add(f+".condition", "%q has no health check, so it can't become healthy", d.Task)
+				}
+			default:
+				add(f+".condition", "%q must be one of completed, started or healthy", d.Condition)
+			}
+		}
+	}
+	validateCycles(tasks, index, add)
+}
+
+// validateCycles reports the dependency cycles among the tasks.
+func validateCycles(tasks []TaskSpec, index map[string]int, add func(string, string, ...interface{})) {
+	// Depth first search from each task in turn. A dependency on a task
+	// that is still on the path is a cycle, which is reported once, on the
+	// task it was found from.
+	const (
+		unvisited = iota
+		onPath
+		done
+	)
+	state := make([]int, len(tasks))
+	var path []int
+	var visit func(i int)
+	visit = func(i int) {
+		state[i] = onPath
+		path = append(path, i)
+		for _, d := range tasks[i].DependsOn {
+			k, ok := index[d.Task]
+			if !ok || k == i {
+				continue
+			}
+			switch state[k] {
+			case unvisited:
+				visit(k)
+			case onPath:
+				var names []string
+				for p := len(path) - 1; p >= 0; p-- {
+					names = append(names, tasks[path[p]].Name)
+					if path[p] == k {
+						break
+					}
+				}
+				for l, r := 0, len(names)-1; l < r; l, r = l+1, r-1 {
+					names[l], names[r] = names[r], names[l]
+				}
+				names = append(names, tasks[k].Name)
+				add(fmt.Sprintf("tasks[%d].dependsOn", i), "dependency cycle %s", strings.Join(names, " -> "))
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = done
+	}
+	for i := range tasks {
+		if state[i] == unvisited {
+			visit(i)
+		}
+	}
+}
+
+func validateAffinity(f string, rules []AffinitySpec, add func(string, string, ...interface{})) {
+	for j, a := range rules {
+		af := fmt.Sprintf("%s[%d]", f, j)
+		if _, err := task.ParseConstraint(a.Selector); err != nil {
+			add(af+".selector", "%v", err)
+		}
+		switch {
+		case a.Weight != 0 && !a.Soft:
+			add(af+".weight", "is only used by soft rules")
+		case a.Weight < 0 || a.Weight > 100:
+			add(af+".weight", "must be between 1 and 100")
+		}
+	}
+}
+
+func validateUpdate(f string, u *UpdateSpec, add func(string, string, ...interface{})) {
+	maxSurge, maxUnavailable := 1, 0
+	if u.MaxSurge != nil {
+		maxSurge = *u.MaxSurge
+		if maxSurge < 0 {
+			add(f+".maxSurge", "must not be negative")
+		}
+	}
+	if u.MaxUnavailable != nil {
+		maxUnavailable = *u.MaxUnavailable
+		if maxUnavailable < 0 {
+			add(f+".maxUnavailable", "must not be negative")
+		}
+	}
+	if maxSurge == 0 && maxUnavailable == 0 {
+		add(f, "maxSurge and maxUnavailable can't both be 0, or no task could be replaced")
+	}
+
+	if _, err := u.Delay.Duration(); err != nil {
+		add(f+".delay", "%v", err)
+	}
+	if _, err := u.Monitor.Duration(); err != nil {
+		add(f+".monitor", "%v", err)
+	}
+	if _, err := u.Timeout.Duration(); err != nil {
+		add(f+".timeout", "%v", err)
+	}
+	switch u.FailureAction {
+	case "", task.UpdateRollback, task.UpdatePause:
+	default:
+		add(f+".failureAction", "%q must be rollback or pause", u.FailureAction)
+	}
+}
+
+func validateHealthCheck(f string, hc *HealthCheckSpec, add func(string, string, ...interface{})) {
+	switch hc.Type {
+	case task.HTTPHealthCheck, task.TCPHealthCheck:
+		if hc.Port < 1 || hc.Port > 65535 {
+			add(f+".port", "a port between 1 and 65535 is required for %s checks", hc.Type)
+		}
+	case task.ExecHealthCheck:
+		if len(hc.Command) == 0 {
+			add(f+".command", "is required for exec checks")
+		}
+	case "":
+		add(f+".type", "is required, one of http, tcp or exec")
+	default:
+		add(f+".type", "%q must be one of http, tcp or exec", hc.Type)
+	}
+
+	if hc.Path != "" && hc.Type != task.HTTPHealthCheck {
+		add(f+".path", "is only used by http checks")
+	}
+	if _, err := hc.Interval.Duration(); err != nil {
+		add(f+".interval", "%v", err)
+	}
+	if _, err := hc.Timeout.Duration(); err != nil {
+		add(f+".timeout", "%v", err)
+	}
+	if hc.Retries < 0 {
+		add(f+".retries", "must not be negative")
+	}
+}
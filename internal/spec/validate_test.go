@@ -0,0 +1,268 @@
+package spec
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// fields returns the sorted fields of the validation errors in err.
+func fields(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("got %v, want ValidationErrors", err)
+	}
+	var fs []string
+	for _, fe := range errs {
+		fs = append(fs, fe.Field)
+	}
+	sort.Strings(fs)
+	return fs
+}
+
+func TestSpecValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		want []string
+	}{
+		{
+			name: "valid",
+			spec: `
+version: v1
+name: web
+tasks:
+  - name: app
+    image: nginx
+    env: {PORT: "80"}
+    ports: ["80", 443/tcp]
+    resources: {memory: 64Mi, cpu: 500m, cpuLimit: 1}
+    restartPolicy: on-failure
+    priorityClass: high
+    preemptionPolicy: never
+    constraints: ["node.labels.zone == eu-1"]
+    labels: {app: web}
+`,
+		},
+		{
+			name: "missing header",
+			spec: `
+tasks:
+  - name: app
+    image: nginx
+`,
+			want: []string{"name", "version"},
+		},
+		{
+			name: "unknown version",
+			spec: `
+version: v2
+name: web
+tasks: [{name: app, image: nginx}]
+`,
+			want: []string{"version"},
+		},
+		{
+			name: "no tasks",
+			spec: `
+version: v1
+name: web
+tasks: []
+`,
+			want: []string{"tasks"},
+		},
+		{
+			name: "bad names",
+			spec: `
+version: v1
+name: web app
+tenant: a/b
+tasks:
+  - {name: app, image: nginx}
+  - {name: app, image: nginx}
+  - {image: nginx}
+`,
+			want: []string{"name", "tasks[1].name", "tasks[2].name", "tenant"},
+		},
+		{
+			name: "bad task settings",
+			spec: `
+version: v1
+name: web
+tasks:
+  - name: app
+    image: " "
+    env: {1BAD: x}
+    ports: [http]
+    restartPolicy: sometimes
+    maxRestarts: -1
+    retries: -1
+    priorityClass: urgent
+    preemptionPolicy: always
+`,
+			want: []string{
+				"tasks[0].env.1BAD", "tasks[0].image", "tasks[0].maxRestarts", "tasks[0].ports[0]",
+				"tasks[0].preemptionPolicy", "tasks[0].priorityClass", "tasks[0].restartPolicy",
+				"tasks[0].retries",
+			},
+		},
+		{
+			name: "bad resources",
+			spec: `
+version: v1
+name: web
+tasks:
+  - name: app
+    image: nginx
+    resources: {memory: lots, disk: -1, cpu: 2, cpuLimit: 1}
+`,
+			want: []string{"tasks[0].resources.cpuLimit", "tasks[0].resources.disk", "tasks[0].resources.memory"},
+		},
+		{
+			name: "bad placement",
+			spec: `
+version: v1
+name: web
+tasks:
+  - name: app
+    image: nginx
+    constraints: ["zone"]
+    preferences: [{constraint: "zone == a", weight: 101}]
+    labels: {"-app": web}
+    topologySpread: [{maxSkew: 1, selector: "app == web"}]
+`,
+			want: []string{
+				"tasks[0].constraints[0]", "tasks[0].labels.-app", "tasks[0].preferences[0].weight",
+				"tasks[0].topologySpread[0].key",
+			},
+		},
+		{
+			name: "bad schedule",
+			spec: `
+version: v1
+name: nightly
+schedule: "0 25 * * *"
+concurrencyPolicy: sometimes
+tasks: [{name: app, image: nginx}]
+`,
+			want: []string{"concurrencyPolicy", "schedule"},
+		},
+		{
+			name: "concurrency policy without a schedule",
+			spec: `
+version: v1
+name: web
+concurrencyPolicy: forbid
+tasks: [{name: app, image: nginx}]
+`,
+			want: []string{"concurrencyPolicy"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse([]byte(tt.spec))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			got := fields(t, s.Validate())
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("invalid fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDependencies(t *testing.T) {
+	type errs map[string]string
+	tests := []struct {
+		name  string
+		tasks []TaskSpec
+		want  errs
+	}{
+		{
+			name: "chain",
+			tasks: []TaskSpec{
+				{Name: "a"},
+				{Name: "b", DependsOn: []DependencySpec{{Task: "a"}}},
+				{Name: "c", DependsOn: []DependencySpec{{Task: "a"}, {Task: "b", Condition: "started"}}},
+			},
+			want: errs{},
+		},
+		{
+			name: "unknown and self",
+			tasks: []TaskSpec{
+				{Name: "a", DependsOn: []DependencySpec{{Task: "a"}, {Task: "x"}, {}}},
+			},
+			want: errs{
+				"tasks[0].dependsOn[0].task": "a task can't depend on itself",
+				"tasks[0].dependsOn[1].task": `"x" is not a task of this job`,
+				"tasks[0].dependsOn[2].task": "is required",
+			},
+		},
+		{
+			name: "conditions",
+			tasks: []TaskSpec{
+				{Name: "a"},
+				{Name: "b", HealthCheck: &HealthCheckSpec{Type: "tcp", Port: 80}},
+				{Name: "c", DependsOn: []DependencySpec{
+					{Task: "a", Condition: "healthy"},
+					{Task: "b", Condition: "healthy"},
+					{Task: "b", Condition: "done"},
+				}},
+			},
+			want: errs{
+				"tasks[2].dependsOn[0].condition": `"a" has no health check, so it can't become healthy`,
+				"tasks[2].dependsOn[2].condition": `"done" must be one of completed, started or healthy`,
+			},
+		},
+		{
+			name: "two task cycle",
+			tasks: []TaskSpec{
+				{Name: "a", DependsOn: []DependencySpec{{Task: "b"}}},
+				{Name: "b", DependsOn: []DependencySpec{{Task: "a"}}},
+			},
+			want: errs{"tasks[1].dependsOn": "dependency cycle a -> b -> a"},
+		},
+		{
+			name: "cycle behind a chain",
+			tasks: []TaskSpec{
+				{Name: "a", DependsOn: []DependencySpec{{Task: "b"}}},
+				{Name: "b", DependsOn: []DependencySpec{{Task: "c"}}},
+				{Name: "c", DependsOn: []DependencySpec{{Task: "d"}}},
+				{Name: "d", DependsOn: []DependencySpec{{Task: "b"}}},
+			},
+			want: errs{"tasks[3].dependsOn": "dependency cycle b -> c -> d -> b"},
+		},
+		{
+			name: "diamond",
+			tasks: []TaskSpec{
+				{Name: "a"},
+				{Name: "b", DependsOn: []DependencySpec{{Task: "a"}}},
+				{Name: "c", DependsOn: []DependencySpec{{Task: "a"}}},
+				{Name: "d", DependsOn: []DependencySpec{{Task: "b"}, {Task: "c"}}},
+			},
+			want: errs{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := make(map[string]int)
+			for i, ts := range tt.tasks {
+				index[ts.Name] = i
+			}
+			got := errs{}
+			validateDependencies(tt.tasks, index, func(field string, format string, args ...interface{}) {
+				got[field] = fmt.Sprintf(format, args...)
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("errors = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,4 +1,4 @@
-package worker
+package stats
 
 import (
 	"fmt"
@@ -10,8 +10,12 @@ type Stats struct {
 	MemStats  *linux.MemInfo
 	DiskStats *linux.Disk
 	CPUStats  *linux.CPUStat
-	LoadStats *linux.LoadAvg
-	TaskCount int
+	// PrevCPUStats is the CPU sample taken before CPUStats, so that
+	// CPUUsage can tell how busy the CPU was between the two rather than
+	// since boot.
+	PrevCPUStats *linux.CPUStat `json:",omitempty"`
+	LoadStats    *linux.LoadAvg
+	TaskCount    int
 }
 
 type CPUStat struct {
@@ -56,17 +60,26 @@ func (s *Stats) DiskUsed() uint64 {
 	return s.DiskStats.Used
 }
 
-func (s *Stats) CPUUsage() float64 {
-	idle := s.CPUStats.Idle + s.CPUStats.IOWait
-	nonIdle := s.CPUStats.User + s.CPUStats.Nice + s.CPUStats.System +
-		s.CPUStats.IRQ + s.CPUStats.SoftIRQ + s.CPUStats.Steal
-	total := idle + nonIdle
-
-	if total == 0 {
-		return 0.00
+// CPUUsage returns the share of CPU time spent busy between PrevCPUStats
+// and CPUStats. It reports false if there aren't two samples to compare or
+// no time passed between them.
+func (s *Stats) CPUUsage() (float64, bool) {
+	if s.CPUStats == nil || s.PrevCPUStats == nil {
+		return 0, false
+	}
+	idle, total := cpuTimes(s.CPUStats)
+	prevIdle, prevTotal := cpuTimes(s.PrevCPUStats)
+	if total <= prevTotal || idle < prevIdle {
+		return 0, false
 	}
+	return 1 - float64(idle-prevIdle)/float64(total-prevTotal), true
+}
 
-	return (float64(total) - float64(idle)) / float64(total)
+// cpuTimes returns the idle and the total CPU time counted in c.
+func cpuTimes(c *linux.CPUStat) (idle uint64, total uint64) {
+	idle = c.Idle + c.IOWait
+	nonIdle := c.User + c.Nice + c.System + c.IRQ + c.SoftIRQ + c.Steal
+	return idle, idle + nonIdle
 }
 
 func GetStats() *Stats {
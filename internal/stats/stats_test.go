@@ -0,0 +1,56 @@
+package stats
+
+import (
+	"math"
+	"testing"
+
+	"github.com/c9s/goprocinfo/linux"
+)
+
+func TestCPUUsage(t *testing.T) {
+	tests := []struct {
+		name      string
+		prev, cur *linux.CPUStat
+		want      float64
+		wantOK    bool
+	}{
+		{name: "no samples"},
+		{name: "one sample", cur: &linux.CPUStat{User: 100, Idle: 900}},
+		{
+			name:   "busy between samples",
+			prev:   &linux.CPUStat{User: 100, Idle: 900},
+			cur:    &linux.CPUStat{User: 175, System: 5, Idle: 920},
+			want:   0.8,
+			wantOK: true,
+		},
+		{
+			// Mostly idle since boot, but fully busy since the last sample.
+			name:   "ignores time before the previous sample",
+			prev:   &linux.CPUStat{User: 10, Idle: 100000},
+			cur:    &linux.CPUStat{User: 110, Idle: 100000},
+			want:   1,
+			wantOK: true,
+		},
+		{
+			name:   "io wait is idle",
+			prev:   &linux.CPUStat{User: 0, Idle: 0},
+			cur:    &linux.CPUStat{User: 30, IOWait: 50, Idle: 20},
+			want:   0.3,
+			wantOK: true,
+		},
+		{
+			name: "no time passed",
+			prev: &linux.CPUStat{User: 100, Idle: 900},
+			cur:  &linux.CPUStat{User: 100, Idle: 900},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Stats{CPUStats: tt.cur, PrevCPUStats: tt.prev}
+			got, ok := s.CPUUsage()
+			if ok != tt.wantOK || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("CPUUsage() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/elimt/go-orchestrator/internal/task"
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltStore keeps values of type T, JSON encoded, in a single bucket of a
+// BoltDB file. It takes and returns *T, and List returns []*T.
+type boltStore[T any] struct {
+	Db       *bolt.DB
+	DbFile   string
+	FileMode os.FileMode
+	Bucket   string
+}
+
+func newBoltStore[T any](file string, mode os.FileMode, bucket string) (*boltStore[T], error) {
+	db, err := bolt.Open(file, mode, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %v: %w", file, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to create bucket %v: %w", bucket, err)
+	}
+
+	return &boltStore[T]{
+		Db:       db,
+		DbFile:   file,
+		FileMode: mode,
+		Bucket:   bucket,
+	}, nil
+}
+
+func (b *boltStore[T]) Close() error {
+	return b.Db.Close()
+}
+
+func (b *boltStore[T]) Put(key string, value interface{}) error {
+	v, ok := value.(*T)
+	if !ok {
+		var zero T
+		return fmt.Errorf("value %v is not a %T type", value, zero)
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(b.Bucket)).Put([]byte(key), buf)
+	})
+}
+
+func (b *boltStore[T]) Get(key string) (interface{}, error) {
+	var v T
+	err := b.Db.View(func(tx *bolt.Tx) error {
+		buf := tx.Bucket([]byte(b.Bucket)).Get([]byte(key))
+		if buf == nil {
+			return fmt.Errorf("key %s: %w", key, ErrNotFound)
+		}
+		return json.Unmarshal(buf, &v)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (b *boltStore[T]) List() (interface{}, error) {
+	values := []*T{}
+	err := b.Db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(b.Bucket)).ForEach(func(k, buf []byte) error {
+			var v T
+			err := json.Unmarshal(buf, &v)
+			if err != nil {
+				return err
+			}
+			values = append(values, &v)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func (b *boltStore[T]) Delete(key string) error {
+	return b.Db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(b.Bucket)).Delete([]byte(key))
+	})
+}
+
+func (b *boltStore[T]) Count() (int, error) {
+	count := 0
+	err := b.Db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket([]byte(b.Bucket)).Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return count, nil
+}
+
+// TaskStore keeps tasks in a BoltDB file.
+type TaskStore struct {
+	*boltStore[task.Task]
+}
+
+func NewTaskStoreFile(file string, mode os.FileMode, bucket string) (*TaskStore, error) {
+	b, err := newBoltStore[task.Task](file, mode, bucket)
+	if err != nil {
+		return nil, err
+	}
+	return &TaskStore{b}, nil
+}
+
+// EventStore keeps task events in a BoltDB file.
+type EventStore struct {
+	*boltStore[task.TaskEvent]
+}
+
+func NewEventStoreFile(file string, mode os.FileMode, bucket string) (*EventStore, error) {
+	b, err := newBoltStore[task.TaskEvent](file, mode, bucket)
+	if err != nil {
+		return nil, err
+	}
+	return &EventStore{b}, nil
+}
+
+// JobStore keeps jobs in a BoltDB file.
+type JobStore struct {
+	*boltStore[task.Job]
+}
+
+func NewJobStoreFile(file string, mode os.FileMode, bucket string) (*JobStore, error) {
+	b, err := newBoltStore[task.Job](file, mode, bucket)
+	if err != nil {
+		return nil, err
+	}
+	return &JobStore{b}, nil
+}
+
+// ServiceStore keeps services in a BoltDB file.
+type ServiceStore struct {
+	*boltStore[task.Service]
+}
+
+func NewServiceStoreFile(file string, mode os.FileMode, bucket string) (*ServiceStore, error) {
+	b, err := newBoltStore[task.Service](file, mode, bucket)
+	if err != nil {
+		return nil, err
+	}
+	return &ServiceStore{b}, nil
+}
+
+// CronJobStore keeps cron jobs in a BoltDB file.
+type CronJobStore struct {
+	*boltStore[task.CronJob]
+}
+
+func NewCronJobStoreFile(file string, mode os.FileMode, bucket string) (*CronJobStore, error) {
+	b, err := newBoltStore[task.CronJob](file, mode, bucket)
+	if err != nil {
+		return nil, err
+	}
+	return &CronJobStore{b}, nil
+}
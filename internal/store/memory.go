@@ -0,0 +1,134 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/elimt/go-orchestrator/internal/task"
+)
+
+// memoryStore keeps values of type T in a map. It takes and returns *T, and
+// List returns []*T. Values are kept JSON encoded, as the persistent stores
+// keep them, so that no slice or map inside a stored value is shared with
+// callers, who must Put a value back after changing it.
+type memoryStore[T any] struct {
+	mu sync.RWMutex
+	Db map[string][]byte
+	// kind names the values in errors.
+	kind string
+}
+
+func newMemoryStore[T any](kind string) *memoryStore[T] {
+	return &memoryStore[T]{
+		Db:   make(map[string][]byte),
+		kind: kind,
+	}
+}
+
+func (i *memoryStore[T]) Put(key string, value interface{}) error {
+	v, ok := value.(*T)
+	if !ok {
+		var zero T
+		return fmt.Errorf("value %v is not a %T type", value, zero)
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.Db[key] = buf
+	return nil
+}
+
+func (i *memoryStore[T]) Get(key string) (interface{}, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	buf, ok := i.Db[key]
+	if !ok {
+		return nil, fmt.Errorf("%s with key %s: %w", i.kind, key, ErrNotFound)
+	}
+	var v T
+	err := json.Unmarshal(buf, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (i *memoryStore[T]) List() (interface{}, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	values := make([]*T, 0, len(i.Db))
+	for _, buf := range i.Db {
+		var v T
+		err := json.Unmarshal(buf, &v)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, &v)
+	}
+	return values, nil
+}
+
+func (i *memoryStore[T]) Delete(key string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.Db, key)
+	return nil
+}
+
+func (i *memoryStore[T]) Count() (int, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return len(i.Db), nil
+}
+
+// InMemoryTaskStore keeps tasks in a map.
+type InMemoryTaskStore struct {
+	*memoryStore[task.Task]
+}
+
+func NewInMemoryTaskStore() *InMemoryTaskStore {
+	return &InMemoryTaskStore{newMemoryStore[task.Task]("task")}
+}
+
+// InMemoryTaskEventStore keeps task events in a map.
+type InMemoryTaskEventStore struct {
+	*memoryStore[task.TaskEvent]
+}
+
+func NewInMemoryTaskEventStore() *InMemoryTaskEventStore {
+	return &InMemoryTaskEventStore{newMemoryStore[task.TaskEvent]("task event")}
+}
+
+// InMemoryJobStore keeps jobs in a map.
+type InMemoryJobStore struct {
+	*memoryStore[task.Job]
+}
+
+func NewInMemoryJobStore() *InMemoryJobStore {
+	return &InMemoryJobStore{newMemoryStore[task.Job]("job")}
+}
+
+// InMemoryServiceStore keeps services in a map.
+type InMemoryServiceStore struct {
+	*memoryStore[task.Service]
+}
+
+func NewInMemoryServiceStore() *InMemoryServiceStore {
+	return &InMemoryServiceStore{newMemoryStore[task.Service]("service")}
+}
+
+// InMemoryCronJobStore keeps cron jobs in a map.
+type InMemoryCronJobStore struct {
+	*memoryStore[task.CronJob]
+}
+
+func NewInMemoryCronJobStore() *InMemoryCronJobStore {
+	return &InMemoryCronJobStore{newMemoryStore[task.CronJob]("cron job")}
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+const (
+	MemoryType     = "memory"
+	PersistentType = "persistent"
+)
+
+// ErrNotFound is returned when a key is not in the store.
+var ErrNotFound = errors.New("not found")
+
+// Store persists tasks, task events, jobs, services or cron jobs by key.
+// Each implementation holds a single kind of value: task stores take and
+// return *task.Task, event stores *task.TaskEvent, job stores *task.Job,
+// service stores *task.Service, cron job stores *task.CronJob, and List
+// returns a slice of the same pointer type.
+type Store interface {
+	Put(key string, value interface{}) error
+	Get(key string) (interface{}, error)
+	List() (interface{}, error)
+	Delete(key string) error
+	Count() (int, error)
+}
+
+// NewTaskStore returns a task store of the given type. Persistent stores are
+// kept in a file named name inside dir.
+func NewTaskStore(dbType string, dir string, name string) (Store, error) {
+	switch dbType {
+	case MemoryType, "":
+		return NewInMemoryTaskStore(), nil
+	case PersistentType:
+		return NewTaskStoreFile(filepath.Join(dir, name), 0o600, "tasks")
+	default:
+		return nil, fmt.Errorf("unknown store type %q", dbType)
+	}
+}
+
+// NewEventStore returns a task event store of the given type. Persistent
+// stores are kept in a file named name inside dir.
+func NewEventStore(dbType string, dir string, name string) (Store, error) {
+	switch dbType {
+	case MemoryType, "":
+		return NewInMemoryTaskEventStore(), nil
+	case PersistentType:
+		return NewEventStoreFile(filepath.Join(dir, name), 0o600, "events")
+	default:
+		return nil, fmt.Errorf("unknown store type %q", dbType)
+	}
+}
+
+// NewJobStore returns a job store of the given type. Persistent stores are
+// kept in a file named name inside dir.
+func NewJobStore(dbType string, dir string, name string) (Store, error) {
+	switch dbType {
+	case MemoryType, "":
+		return NewInMemoryJobStore(), nil
+	case PersistentType:
+		return NewJobStoreFile(filepath.Join(dir, name), 0o600, "jobs")
+	default:
+		return nil, fmt.Errorf("unknown store type %q", dbType)
+	}
+}
+
+// NewServiceStore returns a service store of the given type. Persistent stores
+// are kept in a file named name inside dir.
+func NewServiceStore(dbType string, dir string, name string) (Store, error) {
+	switch dbType {
+	case MemoryType, "":
+		return NewInMemoryServiceStore(), nil
+	case PersistentType:
+		return NewServiceStoreFile(filepath.Join(dir, name), 0o600, "services")
+	default:
+		return nil, fmt.Errorf("unknown store type %q", dbType)
+	}
+}
+
+// NewCronJobStore returns a cron job store of the given type. Persistent
+// stores are kept in a file named name inside dir.
+func NewCronJobStore(dbType string, dir string, name string) (Store, error) {
+	switch dbType {
+	case MemoryType, "":
+		return NewInMemoryCronJobStore(), nil
+	case PersistentType:
+		return NewCronJobStoreFile(filepath.Join(dir, name), 0o600, "cronjobs")
+	default:
+		return nil, fmt.Errorf("unknown store type %q", dbType)
+	}
+}
@@ -0,0 +1,169 @@
+package store
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/elimt/go-orchestrator/internal/task"
+	"github.com/google/uuid"
+)
+
+var storeTypes = []string{MemoryType, PersistentType}
+
+// newStore opens a store with newFn of dbType in a temporary directory and
+// closes it when the test ends.
+func newStore(t *testing.T, dbType string, newFn func(string, string, string) (Store, error)) Store {
+	t.Helper()
+	s, err := newFn(dbType, t.TempDir(), "test.db")
+	if err != nil {
+		t.Fatalf("opening %s store: %v", dbType, err)
+	}
+	if c, ok := s.(io.Closer); ok {
+		t.Cleanup(func() { c.Close() })
+	}
+	return s
+}
+
+func TestStore(t *testing.T) {
+	for _, dbType := range storeTypes {
+		t.Run(dbType, func(t *testing.T) {
+			s := newStore(t, dbType, NewTaskStore)
+			a := &task.Task{ID: uuid.New(), Name: "a", Env: []string{"A=1"}}
+			b := &task.Task{ID: uuid.New(), Name: "b", Labels: map[string]string{"app": "b"}}
+
+			_, err := s.Get(a.ID.String())
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get before Put: got %v, want ErrNotFound", err)
+			}
+			for _, tk := range []*task.Task{a, b} {
+				if err := s.Put(tk.ID.String(), tk); err != nil {
+					t.Fatalf("Put %s: %v", tk.Name, err)
+				}
+			}
+
+			got, err := s.Get(a.ID.String())
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if !reflect.DeepEqual(got, a) {
+				t.Errorf("Get = %+v, want %+v", got, a)
+			}
+
+			// Putting a key again replaces its value.
+			a.Name = "renamed"
+			if err := s.Put(a.ID.String(), a); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			listed, err := s.List()
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			var names []string
+			for _, tk := range listed.([]*task.Task) {
+				names = append(names, tk.Name)
+			}
+			sort.Strings(names)
+			if want := []string{"b", "renamed"}; !reflect.DeepEqual(names, want) {
+				t.Errorf("List names = %v, want %v", names, want)
+			}
+			if n, err := s.Count(); err != nil || n != 2 {
+				t.Errorf("Count = %d, %v, want 2", n, err)
+			}
+
+			if err := s.Delete(a.ID.String()); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if _, err := s.Get(a.ID.String()); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get after Delete: got %v, want ErrNotFound", err)
+			}
+			if err := s.Delete(a.ID.String()); err != nil {
+				t.Errorf("deleting a missing key: %v", err)
+			}
+			if n, err := s.Count(); err != nil || n != 1 {
+				t.Errorf("Count after Delete = %d, %v, want 1", n, err)
+			}
+		})
+	}
+}
+
+func TestStoreCopiesValues(t *testing.T) {
+	for _, dbType := range storeTypes {
+		t.Run(dbType, func(t *testing.T) {
+			s := newStore(t, dbType, NewTaskStore)
+			tk := &task.Task{ID: uuid.New(), Env: []string{"A=1"}, Labels: map[string]string{"app": "web"}}
+			key := tk.ID.String()
+			if err := s.Put(key, tk); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+
+			// Changing the value put, or one got, leaves the stored value alone.
+			tk.Env[0] = "A=2"
+			tk.Labels["app"] = "db"
+			got, err := s.Get(key)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			stored := got.(*task.Task)
+			stored.Env[0] = "A=3"
+			stored.Labels["app"] = "cache"
+			listed, err := s.List()
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			listed.([]*task.Task)[0].Env[0] = "A=4"
+
+			got, err = s.Get(key)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			stored = got.(*task.Task)
+			if stored.Env[0] != "A=1" || stored.Labels["app"] != "web" {
+				t.Errorf("stored task has env %v and labels %v, want them as put", stored.Env, stored.Labels)
+			}
+		})
+	}
+}
+
+func TestStoreTypes(t *testing.T) {
+	kinds := []struct {
+		name  string
+		newFn func(string, string, string) (Store, error)
+		value interface{}
+	}{
+		{"task", NewTaskStore, &task.Task{Name: "t"}},
+		{"event", NewEventStore, &task.TaskEvent{Reason: "r"}},
+		{"job", NewJobStore, &task.Job{Name: "j"}},
+		{"service", NewServiceStore, &task.Service{Name: "s"}},
+		{"cron job", NewCronJobStore, &task.CronJob{Name: "c"}},
+	}
+	for _, dbType := range storeTypes {
+		for i, k := range kinds {
+			t.Run(dbType+" "+k.name, func(t *testing.T) {
+				s := newStore(t, dbType, k.newFn)
+				if err := s.Put("k", k.value); err != nil {
+					t.Fatalf("Put: %v", err)
+				}
+				got, err := s.Get("k")
+				if err != nil {
+					t.Fatalf("Get: %v", err)
+				}
+				if !reflect.DeepEqual(got, k.value) {
+					t.Errorf("Get = %+v, want %+v", got, k.value)
+				}
+
+				// Each store takes only its own kind of value.
+				other := kinds[(i+1)%len(kinds)].value
+				if err := s.Put("other", other); err == nil {
+					t.Errorf("Put of %T succeeded, want an error", other)
+				}
+			})
+		}
+	}
+
+	if _, err := NewTaskStore("cloud", t.TempDir(), "test.db"); err == nil {
+		t.Error(`NewTaskStore("cloud") succeeded, want an error`)
+	}
+}
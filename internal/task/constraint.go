@@ -0,0 +1,160 @@
+package task
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	ConstraintEqual    = "=="
+	ConstraintNotEqual = "!="
+	ConstraintIn       = "in"
+	ConstraintExists   = "exists"
+)
+
+// Constraint restricts the nodes a task may be placed on by comparing one
+// of the node's attributes, such as node.role or node.labels.zone, with
+// Value, or with each of Values for the in operator.
+type Constraint struct {
+	Key      string
+	Operator string
+	Value    string   `json:",omitempty"`
+	Values   []string `json:",omitempty"`
+}
+
+// Preference is a soft constraint: nodes that satisfy it are preferred over
+// those that don't, by Weight, but a task is still placed on a node that
+// doesn't when there is no other.
+type Preference struct {
+	Constraint Constraint
+	Weight     int
+}
+
+// AffinityRule selects tasks by their labels, with Selector matched against
+// label keys such as app. A hard rule must hold for a task to be placed on
+// a node; a soft one only makes the nodes where it holds preferred, by
+// Weight.
+type AffinityRule struct {
+	Selector Constraint
+	Soft     bool `json:",omitempty"`
+	Weight   int  `json:",omitempty"`
+}
+
+// SpreadRule spreads the tasks matching Selector evenly across the values
+// of the node label Key, such as zone: placing a task must not leave any
+// value with more than MaxSkew matching tasks above the value with the
+// fewest. A hard rule turns down nodes that would, while a soft one only
+// passes them over while other nodes remain.
+type SpreadRule struct {
+	Key      string
+	MaxSkew  int
+	Selector Constraint
+	Soft     bool `json:",omitempty"`
+}
+
+// ValidateSpreadRule checks that the rule names a valid label key and allows
+// a skew of at least 1; a rule allowing none would turn the task down
+// whenever every domain runs as many matching tasks.
+func ValidateSpreadRule(r SpreadRule) error {
+	if !ValidLabelKey(r.Key) {
+		return fmt.Errorf("topology spread key %q is not a valid label key", r.Key)
+	}
+	if r.MaxSkew < 1 {
+		return fmt.Errorf("topology spread across %s must allow a skew of at least 1, got %d", r.Key, r.MaxSkew)
+	}
+	return nil
+}
+
+// labelKey is what label keys may contain, so that they can be written in
+// constraints as node.labels.KEY.
+var labelKey = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_./-]*$`)
+
+// ValidLabelKey reports whether key may be used as the key of a node or
+// task label.
+func ValidLabelKey(key string) bool {
+	return labelKey.MatchString(key)
+}
+
+// ParseConstraint parses a constraint written as "key == value",
+// "key != value", "key in (value1, value2)" or "key exists".
+func ParseConstraint(s string) (Constraint, error) {
+	for _, op := range []string{ConstraintEqual, ConstraintNotEqual} {
+		i := strings.Index(s, op)
+		if i < 0 {
+			continue
+		}
+		c := Constraint{
+			Key:      strings.TrimSpace(s[:i]),
+			Operator: op,
+			Value:    strings.TrimSpace(s[i+len(op):]),
+		}
+		if c.Key == "" {
+			return Constraint{}, fmt.Errorf("constraint %q has no key", s)
+		}
+		return c, nil
+	}
+
+	fields := strings.Fields(s)
+	switch {
+	case len(fields) == 2 && fields[1] == ConstraintExists:
+		return Constraint{Key: fields[0], Operator: ConstraintExists}, nil
+	case len(fields) >= 3 && fields[1] == ConstraintIn:
+		list := strings.Join(fields[2:], " ")
+		list = strings.TrimSuffix(strings.TrimPrefix(list, "("), ")")
+		c := Constraint{Key: fields[0], Operator: ConstraintIn}
+		for _, v := range strings.Split(list, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				c.Values = append(c.Values, v)
+			}
+		}
+		if len(c.Values) == 0 {
+			return Constraint{}, fmt.Errorf("constraint %q lists no values", s)
+		}
+		return c, nil
+	}
+	return Constraint{}, fmt.Errorf("constraint %q must have the form \"key == value\", \"key != value\", "+
+		"\"key in (value, ...)\" or \"key exists\"", s)
+}
+
+func (c Constraint) String() string {
+	switch c.Operator {
+	case ConstraintIn:
+		return fmt.Sprintf("%s in (%s)", c.Key, strings.Join(c.Values, ", "))
+	case ConstraintExists:
+		return fmt.Sprintf("%s exists", c.Key)
+	default:
+		return fmt.Sprintf("%s %s %s", c.Key, c.Operator, c.Value)
+	}
+}
+
+// Matches reports whether a node whose attribute c.Key has value, or is
+// missing when ok is false, satisfies the constraint.
+func (c Constraint) Matches(value string, ok bool) bool {
+	switch c.Operator {
+	case ConstraintEqual:
+		return ok && value == c.Value
+	case ConstraintNotEqual:
+		return !ok || value != c.Value
+	case ConstraintIn:
+		if ok {
+			for _, v := range c.Values {
+				if v == value {
+					return true
+				}
+			}
+		}
+		return false
+	case ConstraintExists:
+		return ok
+	default:
+		return false
+	}
+}
+
+// MatchesLabels reports whether a task with labels satisfies the constraint,
+// with c.Key naming a label.
+func (c Constraint) MatchesLabels(labels map[string]string) bool {
+	v, ok := labels[c.Key]
+	return c.Matches(v, ok)
+}
@@ -0,0 +1,39 @@
+package task
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// ConcurrencyAllow starts every run of a cron job, even while earlier
+	// runs are still going.
+	ConcurrencyAllow = "allow"
+	// ConcurrencyForbid skips a run while the previous one is still going.
+	ConcurrencyForbid = "forbid"
+	// ConcurrencyReplace stops runs that are still going and starts the new
+	// one.
+	ConcurrencyReplace = "replace"
+)
+
+// CronJob submits a job from its task templates each time its cron Schedule
+// fires. Times are in UTC.
+type CronJob struct {
+	ID                uuid.UUID
+	Name              string
+	Schedule          string
+	ConcurrencyPolicy string
+	Tasks             []Task
+	CreatedAt         time.Time
+	LastRun           time.Time
+	NextRun           time.Time
+	// JobIDs are the most recent runs, oldest first.
+	JobIDs []uuid.UUID
+	// Message says why the last run was skipped or could not be started.
+	Message string `json:",omitempty"`
+
+	// Jobs is filled in from JobIDs when the cron job is read; it is not
+	// stored.
+	Jobs []*Job `json:",omitempty"`
+}
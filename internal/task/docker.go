@@ -0,0 +1,220 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+)
+
+// Docker runs tasks as containers on the local Docker daemon.
+type Docker struct {
+	Client *client.Client
+}
+
+func NewDocker() (*Docker, error) {
+	cli, err := client.NewClientWithOpts(
+		client.FromEnv,
+		client.WithAPIVersionNegotiation(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating docker client: %w", err)
+	}
+	return &Docker{Client: cli}, nil
+}
+
+func (d *Docker) Pull(ctx context.Context, image string) error {
+	reader, err := d.Client.ImagePull(ctx, image, types.ImagePullOptions{})
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	_, err = io.Copy(os.Stdout, reader)
+	return err
+}
+
+func (d *Docker) Create(ctx context.Context, c *Config) (string, error) {
+	rp := container.RestartPolicy{
+		Name: c.RestartPolicy,
+	}
+	// Docker weighs CPU shares against the default of 1024 per container,
+	// so a request of one core gets the default weight.
+	r := container.Resources{
+		Memory:    c.Memory,
+		CPUShares: int64(c.CPU * 1024),
+		NanoCPUs:  int64(c.CPULimit * 1e9),
+	}
+	exposed, bindings := portConfig(c)
+	cc := container.Config{
+		Image:        c.Image,
+		Cmd:          c.Cmd,
+		Env:          c.Env,
+		Labels:       c.Labels,
+		ExposedPorts: exposed,
+	}
+	hc := container.HostConfig{
+		RestartPolicy:   rp,
+		Resources:       r,
+		PortBindings:    bindings,
+		PublishAllPorts: true,
+	}
+
+	resp, err := d.Client.ContainerCreate(ctx, &cc, &hc, nil, nil, c.Name)
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// portConfig returns the ports the container exposes, including any that
+// are only given a host binding, and the host ports they are bound to.
+func portConfig(c *Config) (nat.PortSet, nat.PortMap) {
+	exposed := nat.PortSet{}
+	for port := range c.ExposedPorts {
+		exposed[port] = struct{}{}
+	}
+	bindings := nat.PortMap{}
+	for p, host := range c.PortBindings {
+		port := nat.Port(p)
+		if !strings.Contains(p, "/") {
+			port = nat.Port(p + "/tcp")
+		}
+		exposed[port] = struct{}{}
+		bindings[port] = []nat.PortBinding{{HostPort: host}}
+	}
+	return exposed, bindings
+}
+
+func (d *Docker) Start(ctx context.Context, containerID string) error {
+	return d.Client.ContainerStart(ctx, containerID, types.ContainerStartOptions{})
+}
+
+func (d *Docker) Stop(ctx context.Context, containerID string) error {
+	return d.Client.ContainerStop(ctx, containerID, nil)
+}
+
+func (d *Docker) Remove(ctx context.Context, containerID string) error {
+	removeOptions := types.ContainerRemoveOptions{
+		RemoveVolumes: true,
+		RemoveLinks:   false,
+		Force:         false,
+	}
+	return d.Client.ContainerRemove(ctx, containerID, removeOptions)
+}
+
+func (d *Docker) Inspect(ctx context.Context, containerID string) (ContainerState, error) {
+	resp, err := d.Client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return ContainerState{}, err
+	}
+
+	cs := ContainerState{ID: resp.ID, Name: strings.TrimPrefix(resp.Name, "/")}
+	if resp.Config != nil {
+		cs.Labels = resp.Config.Labels
+	}
+	if resp.NetworkSettings != nil {
+		cs.Ports = make(map[string]string)
+		for port, bindings := range resp.NetworkSettings.Ports {
+			if len(bindings) > 0 {
+				cs.Ports[string(port)] = bindings[0].HostPort
+			}
+		}
+	}
+	if resp.State != nil {
+		cs.Status = resp.State.Status
+		cs.Running = resp.State.Running
+		cs.ExitCode = resp.State.ExitCode
+		cs.Error = resp.State.Error
+		cs.StartedAt, _ = time.Parse(time.RFC3339Nano, resp.State.StartedAt)
+		cs.FinishedAt, _ = time.Parse(time.RFC3339Nano, resp.State.FinishedAt)
+	}
+	return cs, nil
+}
+
+// Logs returns the container's stdout and stderr, demultiplexed from the
+// Docker log stream.
+func (d *Docker) Logs(ctx context.Context, containerID string) (io.ReadCloser, error) {
+	out, err := d.Client.ContainerLogs(
+		ctx,
+		containerID,
+		types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer out.Close()
+		_, err := stdcopy.StdCopy(pw, pw, out)
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+func (d *Docker) List(ctx context.Context, labels map[string]string) ([]ContainerState, error) {
+	args := filters.NewArgs()
+	for k, v := range labels {
+		args.Add("label", fmt.Sprintf("%s=%s", k, v))
+	}
+
+	containers, err := d.Client.ContainerList(ctx, types.ContainerListOptions{All: true, Filters: args})
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]ContainerState, 0, len(containers))
+	for _, c := range containers {
+		cs, err := d.Inspect(ctx, c.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error inspecting container %s: %w", c.ID, err)
+		}
+		states = append(states, cs)
+	}
+	return states, nil
+}
+
+func (d *Docker) Exec(ctx context.Context, containerID string, cmd []string) (int, error) {
+	exec, err := d.Client.ContainerExecCreate(ctx, containerID, types.ExecConfig{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	attach, err := d.Client.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{})
+	if err != nil {
+		return -1, err
+	}
+	defer attach.Close()
+	_, err = stdcopy.StdCopy(io.Discard, io.Discard, attach.Reader)
+	if err != nil {
+		return -1, err
+	}
+
+	for {
+		inspect, err := d.Client.ContainerExecInspect(ctx, exec.ID)
+		if err != nil {
+			return -1, err
+		}
+		if !inspect.Running {
+			return inspect.ExitCode, nil
+		}
+		select {
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fake is an in-memory runtime that simulates containers, so the manager and
+// worker can be exercised on machines without a container engine.
+type Fake struct {
+	// ExitCodes makes containers created from the image exit with the given
+	// code once they have been running for RunFor. Containers whose image is
+	// not listed keep running until they are stopped.
+	ExitCodes map[string]int
+	RunFor    time.Duration
+
+	// Failure, when set, is called before each operation with the operation
+	// name ("pull", "create", "start", "stop", "remove", "exec") and the image
+	// involved. A non-nil error fails the operation.
+	Failure func(op string, image string) error
+
+	mu         sync.Mutex
+	images     map[string]bool
+	containers map[string]*fakeContainer
+	nextID     int
+}
+
+type fakeContainer struct {
+	config Config
+	state  ContainerState
+}
+
+func NewFake() *Fake {
+	return &Fake{
+		ExitCodes:  make(map[string]int),
+		images:     make(map[string]bool),
+		containers: make(map[string]*fakeContainer),
+	}
+}
+
+func (f *Fake) fail(op string, image string) error {
+	if f.Failure == nil {
+		return nil
+	}
+	return f.Failure(op, image)
+}
+
+func (f *Fake) container(containerID string) (*fakeContainer, error) {
+	c, ok := f.containers[containerID]
+	if !ok {
+		return nil, fmt.Errorf("no such container: %s", containerID)
+	}
+	f.refresh(c)
+	return c, nil
+}
+
+// refresh exits running containers whose image is configured to exit.
+func (f *Fake) refresh(c *fakeContainer) {
+	if !c.state.Running {
+		return
+	}
+	code, ok := f.ExitCodes[c.config.Image]
+	if !ok || time.Since(c.state.StartedAt) < f.RunFor {
+		return
+	}
+	c.state.Running = false
+	c.state.Status = "exited"
+	c.state.ExitCode = code
+	c.state.FinishedAt = c.state.StartedAt.Add(f.RunFor)
+}
+
+func (f *Fake) Pull(ctx context.Context, image string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.fail("pull", image); err != nil {
+		return err
+	}
+	f.images[image] = true
+	return nil
+}
+
+func (f *Fake) Create(ctx context.Context, c *Config) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.fail("create", c.Image); err != nil {
+		return "", err
+	}
+	if !f.images[c.Image] {
+		return "", fmt.Errorf("no such image: %s", c.Image)
+	}
+	for _, existing := range f.containers {
+		if c.Name != "" && existing.config.Name == c.Name {
+			return "", fmt.Errorf("container name %q is already in use", c.Name)
+		}
+	}
+
+	f.nextID++
+	id := fmt.Sprintf("fake-%08d", f.nextID)
+	f.containers[id] = &fakeContainer{
+		config: *c,
+		state:  ContainerState{ID: id, Name: c.Name, Labels: c.Labels, Status: "created"},
+	}
+	return id, nil
+}
+
+func (f *Fake) Start(ctx context.Context, containerID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, err := f.container(containerID)
+	if err != nil {
+		return err
+	}
+	if err := f.fail("start", c.config.Image); err != nil {
+		c.state.Status = "exited"
+		c.state.ExitCode = 128
+		c.state.Error = err.Error()
+		return err
+	}
+	c.state.Status = "running"
+	c.state.Running = true
+	c.state.ExitCode = 0
+	c.state.Error = ""
+	c.state.StartedAt = time.Now().UTC()
+	c.state.FinishedAt = time.Time{}
+	return nil
+}
+
+func (f *Fake) Stop(ctx context.Context, containerID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, err := f.container(containerID)
+	if err != nil {
+		return err
+	}
+	if err := f.fail("stop", c.config.Image); err != nil {
+		return err
+	}
+	if c.state.Running {
+		c.state.Running = false
+		c.state.Status = "exited"
+		c.state.ExitCode = 137
+		c.state.FinishedAt = time.Now().UTC()
+	}
+	return nil
+}
+
+func (f *Fake) Remove(ctx context.Context, containerID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, err := f.container(containerID)
+	if err != nil {
+		return err
+	}
+	if err := f.fail("remove", c.config.Image); err != nil {
+		return err
+	}
+	if c.state.Running {
+		return fmt.Errorf("cannot remove running container %s", containerID)
+	}
+	delete(f.containers, containerID)
+	return nil
+}
+
+func (f *Fake) Inspect(ctx context.Context, containerID string) (ContainerState, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, err := f.container(containerID)
+	if err != nil {
+		return ContainerState{}, err
+	}
+	return c.state, nil
+}
+
+func (f *Fake) Logs(ctx context.Context, containerID string) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, err := f.container(containerID)
+	if err != nil {
+		return nil, err
+	}
+	msg := fmt.Sprintf("fake container %s running %s %s\n",
+		containerID, c.config.Image, strings.Join(c.config.Cmd, " "))
+	return io.NopCloser(strings.NewReader(msg)), nil
+}
+
+func (f *Fake) List(ctx context.Context, labels map[string]string) ([]ContainerState, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var states []ContainerState
+	for _, c := range f.containers {
+		f.refresh(c)
+		if hasLabels(c.state.Labels, labels) {
+			states = append(states, c.state)
+		}
+	}
+	return states, nil
+}
+
+// Exec simulates running cmd in the container. It exits with 0 unless
+// Failure fails the "exec" operation.
+func (f *Fake) Exec(ctx context.Context, containerID string, cmd []string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, err := f.container(containerID)
+	if err != nil {
+		return -1, err
+	}
+	if !c.state.Running {
+		return -1, fmt.Errorf("container %s is not running", containerID)
+	}
+	if err := f.fail("exec", c.config.Image); err != nil {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Exit simulates the container's process exiting on its own with code.
+func (f *Fake) Exit(containerID string, code int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, err := f.container(containerID)
+	if err != nil {
+		return err
+	}
+	c.state.Running = false
+	c.state.Status = "exited"
+	c.state.ExitCode = code
+	c.state.FinishedAt = time.Now().UTC()
+	return nil
+}
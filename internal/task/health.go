@@ -0,0 +1,69 @@
+package task
+
+import "time"
+
+const (
+	HTTPHealthCheck = "http"
+	TCPHealthCheck  = "tcp"
+	ExecHealthCheck = "exec"
+)
+
+const (
+	Healthy   = "healthy"
+	Unhealthy = "unhealthy"
+)
+
+// HealthCheck describes how the worker decides whether a running task is
+// healthy. HTTP checks expect a 2xx or 3xx response from Path on Port, TCP
+// checks expect Port to accept a connection and exec checks expect Command
+// to exit with 0 inside the task's container. Port is the port the task
+// listens on; the worker resolves it to the published host port.
+type HealthCheck struct {
+	Type     string
+	Host     string
+	Port     int
+	Path     string
+	Command  []string
+	Interval time.Duration
+	Timeout  time.Duration
+	// Retries is the number of consecutive failures after which the task
+	// is considered unhealthy.
+	Retries int
+}
+
+// Restart records the worker restarting a task.
+type Restart struct {
+	Timestamp time.Time
+	Reason    string
+}
+
+func (h *HealthCheck) GetInterval() time.Duration {
+	if h.Interval <= 0 {
+		return 30 * time.Second
+	}
+	return h.Interval
+}
+
+func (h *HealthCheck) GetTimeout() time.Duration {
+	if h.Timeout <= 0 {
+		return 5 * time.Second
+	}
+	return h.Timeout
+}
+
+func (h *HealthCheck) GetRetries() int {
+	if h.Retries <= 0 {
+		return 3
+	}
+	return h.Retries
+}
+
+// CanRestart reports whether the task's restart policy allows the worker to
+// restart it, and whether it has restarts left.
+func (t *Task) CanRestart() bool {
+	switch t.RestartPolicy {
+	case "", "no":
+		return false
+	}
+	return t.MaxRestarts == 0 || len(t.Restarts) < t.MaxRestarts
+}
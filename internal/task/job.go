@@ -0,0 +1,108 @@
+package task
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// JobState summarises the states of a job's tasks.
+type JobState string
+
+const (
+	// JobPending means some tasks have not started yet and none has failed.
+	JobPending JobState = "pending"
+	// JobRunning means every task has started and none has failed or is
+	// unhealthy.
+	JobRunning JobState = "running"
+	// JobDegraded means some tasks are still running while others have
+	// failed or are unhealthy.
+	JobDegraded JobState = "degraded"
+	// JobComplete means every task has completed.
+	JobComplete JobState = "complete"
+	// JobFailed means every task has finished and at least one failed.
+	JobFailed JobState = "failed"
+)
+
+// Job is a group of tasks submitted together from a job spec.
+type Job struct {
+	ID        uuid.UUID
+	Name      string
+	TaskIDs   []uuid.UUID
+	CreatedAt time.Time
+
+	// State and Tasks are filled in from the job's tasks when the job is
+	// read; they are not stored.
+	State JobState `json:",omitempty"`
+	Tasks []*Task  `json:",omitempty"`
+}
+
+const (
+	// DependencyCompleted is met once the task has completed successfully.
+	DependencyCompleted = "completed"
+	// DependencyStarted is met once the task is running.
+	DependencyStarted = "started"
+	// DependencyHealthy is met once the task is running and has passed its
+	// health check.
+	DependencyHealthy = "healthy"
+)
+
+// Dependency is a job task's dependency on another task of the job. Task is
+// the name of that task in the job spec, without the job name.
+type Dependency struct {
+	Task      string
+	Condition string
+}
+
+// Met reports whether t satisfies the dependency's condition. A task only
+// counts as completed if it exited successfully by itself, not if it was
+// stopped.
+func (d Dependency) Met(t *Task) bool {
+	switch d.Condition {
+	case DependencyStarted:
+		return t.State == Running || t.State == Completed
+	case DependencyHealthy:
+		return t.State == Running && t.Health == Healthy
+	default:
+		return t.State == Completed && t.ExitCode == 0 && !t.Stopped
+	}
+}
+
+// Finished reports whether none of the job's tasks can run any more.
+func (s JobState) Finished() bool {
+	return s == JobComplete || s == JobFailed
+}
+
+// JobStateOf derives the state of a job from the states of its tasks.
+func JobStateOf(tasks []*Task) JobState {
+	var active, running, completed, failed, unhealthy int
+	for _, t := range tasks {
+		switch t.State {
+		case Completed:
+			completed++
+		case Failed:
+			failed++
+		case Running:
+			running++
+			active++
+			if t.Health == Unhealthy {
+				unhealthy++
+			}
+		default:
+			active++
+		}
+	}
+
+	switch {
+	case failed > 0 && active == 0:
+		return JobFailed
+	case failed > 0 || unhealthy > 0:
+		return JobDegraded
+	case completed == len(tasks):
+		return JobComplete
+	case active > running:
+		return JobPending
+	default:
+		return JobRunning
+	}
+}
@@ -0,0 +1,88 @@
+package task
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Priority classes name the priorities tasks are given. Pending tasks are
+// placed highest priority first, and a task that can't be placed may
+// preempt tasks of a lower priority to make room.
+const (
+	PriorityLow      = "low"
+	PriorityNormal   = "normal"
+	PriorityHigh     = "high"
+	PriorityCritical = "critical"
+
+	DefaultPriorityClass = PriorityNormal
+)
+
+var priorityClasses = map[string]int{
+	PriorityLow:      100,
+	PriorityNormal:   500,
+	PriorityHigh:     1000,
+	PriorityCritical: 10000,
+}
+
+// Preemption policies say whether a task may stop tasks of a lower
+// priority when it can't otherwise be placed. The empty policy is
+// PreemptLowerPriority.
+const (
+	PreemptLowerPriority = "preempt"
+	PreemptNever         = "never"
+)
+
+// PriorityOf returns the priority of the named class.
+func PriorityOf(class string) (int, error) {
+	p, ok := priorityClasses[class]
+	if !ok {
+		return 0, fmt.Errorf("unknown priority class %q, must be one of %s", class, PriorityClassNames())
+	}
+	return p, nil
+}
+
+// PriorityClassNames lists the priority classes, lowest priority first.
+func PriorityClassNames() string {
+	names := make([]string, 0, len(priorityClasses))
+	for name := range priorityClasses {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, k int) bool {
+		return priorityClasses[names[i]] < priorityClasses[names[k]]
+	})
+	return strings.Join(names, ", ")
+}
+
+// SetPriorityClass gives the task the priority of the named class, or of
+// the default class if class is empty.
+func (t *Task) SetPriorityClass(class string) error {
+	if class == "" {
+		class = DefaultPriorityClass
+	}
+	p, err := PriorityOf(class)
+	if err != nil {
+		return err
+	}
+	t.PriorityClass = class
+	t.Priority = p
+	return nil
+}
+
+// ValidatePreemptionPolicy checks that policy is a known preemption
+// policy or empty.
+func ValidatePreemptionPolicy(policy string) error {
+	switch policy {
+	case "", PreemptLowerPriority, PreemptNever:
+		return nil
+	default:
+		return fmt.Errorf("unknown preemption policy %q, must be %s or %s",
+			policy, PreemptLowerPriority, PreemptNever)
+	}
+}
+
+// CanPreempt reports whether the task may stop victim to make room for
+// itself.
+func (t *Task) CanPreempt(victim *Task) bool {
+	return t.PreemptionPolicy != PreemptNever && victim.Priority < t.Priority
+}
@@ -0,0 +1,291 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// stopTimeout is how long a process gets to exit after SIGTERM before it is
+// killed.
+const stopTimeout = 10 * time.Second
+
+// Process runs tasks as plain local processes for hosts without a container
+// engine. The task's Cmd is executed with its Env added to the worker's
+// environment, and its Memory limit is enforced with a cgroup v2 subtree
+// under CgroupRoot when one can be created, falling back to RLIMIT_AS. The
+// cgroup also weights the process by its CPU request and caps it at its
+// CPULimit; without one, CPU is not limited. Limits are in place before
+// the command is executed.
+type Process struct {
+	CgroupRoot string
+
+	mu     sync.Mutex
+	procs  map[string]*process
+	nextID int
+}
+
+type process struct {
+	config Config
+	cmd    *exec.Cmd
+	output *syncBuffer
+	state  ContainerState
+	cgroup string
+	done   chan struct{}
+}
+
+// syncBuffer collects a process's stdout and stderr.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+func NewProcess() *Process {
+	return &Process{
+		CgroupRoot: "/sys/fs/cgroup/go-orchestrator",
+		procs:      make(map[string]*process),
+	}
+}
+
+func (p *Process) process(containerID string) (*process, error) {
+	proc, ok := p.procs[containerID]
+	if !ok {
+		return nil, fmt.Errorf("no such process: %s", containerID)
+	}
+	return proc, nil
+}
+
+// Pull is a no-op: processes run binaries already present on the host.
+func (p *Process) Pull(ctx context.Context, image string) error {
+	return nil
+}
+
+func (p *Process) Create(ctx context.Context, c *Config) (string, error) {
+	if len(c.Cmd) == 0 {
+		return "", errors.New("process runtime requires a command")
+	}
+	_, err := exec.LookPath(c.Cmd[0])
+	if err != nil {
+		return "", fmt.Errorf("error finding command %s: %w", c.Cmd[0], err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.nextID++
+	id := fmt.Sprintf("proc-%d-%d", os.Getpid(), p.nextID)
+	p.procs[id] = &process{
+		config: *c,
+		output: &syncBuffer{},
+		state:  ContainerState{ID: id, Name: c.Name, Labels: c.Labels, Status: "created"},
+		done:   make(chan struct{}),
+	}
+	return id, nil
+}
+
+func (p *Process) Start(ctx context.Context, containerID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	proc, err := p.process(containerID)
+	if err != nil {
+		return err
+	}
+	if proc.cmd != nil {
+		return fmt.Errorf("process %s has already been started", containerID)
+	}
+
+	cmd, cgroup := limitedCommand(p.CgroupRoot, containerID, &proc.config)
+	cmd.Env = append(os.Environ(), proc.config.Env...)
+	cmd.Stdout = proc.output
+	cmd.Stderr = proc.output
+	proc.cmd = cmd
+	proc.cgroup = cgroup
+
+	err = cmd.Start()
+	if err != nil {
+		if cgroup != "" {
+			_ = os.Remove(cgroup)
+		}
+		proc.state.Status = "exited"
+		proc.state.ExitCode = 127
+		proc.state.Error = err.Error()
+		close(proc.done)
+		return err
+	}
+
+	proc.state.Status = "running"
+	proc.state.Running = true
+	proc.state.StartedAt = time.Now().UTC()
+
+	go p.wait(proc)
+	return nil
+}
+
+// wait records the process's exit once it finishes.
+func (p *Process) wait(proc *process) {
+	err := proc.cmd.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	proc.state.Running = false
+	proc.state.Status = "exited"
+	proc.state.FinishedAt = time.Now().UTC()
+	proc.state.ExitCode = exitCode(proc.cmd.ProcessState)
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		proc.state.Error = err.Error()
+	}
+	close(proc.done)
+}
+
+func exitCode(ps *os.ProcessState) int {
+	if ps == nil {
+		return -1
+	}
+	if status, ok := ps.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return ps.ExitCode()
+}
+
+func (p *Process) Stop(ctx context.Context, containerID string) error {
+	p.mu.Lock()
+	proc, err := p.process(containerID)
+	if err != nil {
+		p.mu.Unlock()
+		return err
+	}
+	running := proc.state.Running
+	p.mu.Unlock()
+
+	if !running {
+		return nil
+	}
+
+	err = proc.cmd.Process.Signal(syscall.SIGTERM)
+	if err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+
+	select {
+	case <-proc.done:
+		return nil
+	case <-time.After(stopTimeout):
+	case <-ctx.Done():
+	}
+
+	err = proc.cmd.Process.Kill()
+	if err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	<-proc.done
+	return nil
+}
+
+func (p *Process) Remove(ctx context.Context, containerID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	proc, err := p.process(containerID)
+	if err != nil {
+		return err
+	}
+	if proc.state.Running {
+		return fmt.Errorf("cannot remove running process %s", containerID)
+	}
+	if proc.cgroup != "" {
+		err = os.Remove(proc.cgroup)
+		if err != nil {
+			fmt.Printf("Error removing cgroup %s: %v\n", proc.cgroup, err)
+		}
+	}
+	delete(p.procs, containerID)
+	return nil
+}
+
+func (p *Process) Inspect(ctx context.Context, containerID string) (ContainerState, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	proc, err := p.process(containerID)
+	if err != nil {
+		return ContainerState{}, err
+	}
+	return proc.state, nil
+}
+
+func (p *Process) Logs(ctx context.Context, containerID string) (io.ReadCloser, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	proc, err := p.process(containerID)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(proc.output.Bytes())), nil
+}
+
+func (p *Process) List(ctx context.Context, labels map[string]string) ([]ContainerState, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var states []ContainerState
+	for _, proc := range p.procs {
+		if hasLabels(proc.state.Labels, labels) {
+			states = append(states, proc.state)
+		}
+	}
+	return states, nil
+}
+
+// Exec runs cmd on the host with the process's environment, since a plain
+// process has no container to run it in.
+func (p *Process) Exec(ctx context.Context, containerID string, cmd []string) (int, error) {
+	if len(cmd) == 0 {
+		return -1, errors.New("no command to run")
+	}
+
+	p.mu.Lock()
+	proc, err := p.process(containerID)
+	if err != nil {
+		p.mu.Unlock()
+		return -1, err
+	}
+	env := append(os.Environ(), proc.config.Env...)
+	p.mu.Unlock()
+
+	//nolint:gosec
+	c := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	c.Env = env
+	err = c.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
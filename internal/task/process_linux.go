@@ -0,0 +1,105 @@
+//go:build linux
+
+package task
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// limitedCommand returns the command to run c.Cmd with the memory and CPU
+// limits c asks for. The limits are put in place by a shell that execs the
+// task's command, so they hold from its first instruction. A cgroup v2
+// subtree is used when the unified hierarchy is writable, and the shell
+// joins it; otherwise only the process's address space can be limited,
+// with ulimit -v. It returns the cgroup directory created for the process,
+// if any.
+func limitedCommand(root string, name string, c *Config) (*exec.Cmd, string) {
+	if c.Memory <= 0 && c.CPU <= 0 && c.CPULimit <= 0 {
+		return exec.Command(c.Cmd[0], c.Cmd[1:]...), ""
+	}
+
+	cgroup, err := limitCgroup(root, name, c)
+	if err == nil {
+		procs := filepath.Join(cgroup, "cgroup.procs")
+		return wrapCommand(`echo $$ > "$1" || exit 126`, procs, c.Cmd), cgroup
+	}
+	fmt.Printf("Unable to use cgroup for %s: %v\n", name, err)
+	if c.CPU > 0 || c.CPULimit > 0 {
+		fmt.Printf("CPU of %s is not limited without a cgroup\n", name)
+	}
+	if c.Memory <= 0 {
+		return exec.Command(c.Cmd[0], c.Cmd[1:]...), ""
+	}
+	fmt.Printf("Limiting memory of %s with rlimit\n", name)
+	kib := strconv.FormatInt(c.Memory/1024, 10)
+	return wrapCommand(`ulimit -v "$1" || exit 126`, kib, c.Cmd), ""
+}
+
+// wrapCommand runs setup in a shell, with arg as $1, before the shell
+// replaces itself with cmd.
+func wrapCommand(setup string, arg string, cmd []string) *exec.Cmd {
+	args := append([]string{"-c", setup + `; shift; exec "$@"`, "sh", arg}, cmd...)
+	return exec.Command("/bin/sh", args...)
+}
+
+// cpuPeriod is the cgroup CPU accounting period in microseconds; a limit of
+// n cores allows n periods of CPU time in each period.
+const cpuPeriod = 100000
+
+// limitCgroup creates a cgroup for the process named name with the limits
+// c asks for. The process joins it when it starts.
+func limitCgroup(root string, name string, c *Config) (string, error) {
+	_, err := os.Stat("/sys/fs/cgroup/cgroup.controllers")
+	if err != nil {
+		return "", fmt.Errorf("cgroup v2 is not mounted: %w", err)
+	}
+
+	err = os.MkdirAll(root, 0o755)
+	if err != nil {
+		return "", err
+	}
+	// Child cgroups only get the controllers the parent delegates.
+	_ = os.WriteFile(filepath.Join(root, "cgroup.subtree_control"), []byte("+memory +cpu"), 0o600)
+
+	dir := filepath.Join(root, name)
+	err = os.Mkdir(dir, 0o755)
+	if err != nil {
+		return "", err
+	}
+
+	limits := make(map[string]string)
+	if c.Memory > 0 {
+		limits["memory.max"] = strconv.FormatInt(c.Memory, 10)
+	}
+	if c.CPULimit > 0 {
+		limits["cpu.max"] = fmt.Sprintf("%d %d", int64(c.CPULimit*cpuPeriod), cpuPeriod)
+	}
+	if c.CPU > 0 {
+		limits["cpu.weight"] = strconv.FormatInt(cpuWeight(c.CPU), 10)
+	}
+	for file, value := range limits {
+		err = os.WriteFile(filepath.Join(dir, file), []byte(value), 0o600)
+		if err != nil {
+			_ = os.Remove(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// cpuWeight converts a CPU request in cores to a cgroup v2 cpu.weight, where
+// the default of 100 is one core, kept within the range of 1 to 10000.
+func cpuWeight(cores float64) int64 {
+	w := int64(cores * 100)
+	if w < 1 {
+		return 1
+	}
+	if w > 10000 {
+		return 10000
+	}
+	return w
+}
@@ -0,0 +1,95 @@
+//go:build linux
+
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLimitedCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		wantArgs []string
+	}{
+		{
+			name:     "no limits",
+			config:   Config{Cmd: []string{"sleep", "1"}},
+			wantArgs: []string{"sleep", "1"},
+		},
+		{
+			// CPU can only be limited with a cgroup.
+			name:     "cpu without a cgroup",
+			config:   Config{Cmd: []string{"sleep", "1"}, CPU: 1, CPULimit: 2},
+			wantArgs: []string{"sleep", "1"},
+		},
+		{
+			name:   "memory without a cgroup",
+			config: Config{Cmd: []string{"sleep", "1"}, Memory: 64 << 20},
+			wantArgs: []string{"/bin/sh", "-c", `ulimit -v "$1" || exit 126; shift; exec "$@"`,
+				"sh", "65536", "sleep", "1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A file as the cgroup root can't hold cgroups, whether or not
+			// cgroup v2 is mounted.
+			root := filepath.Join(t.TempDir(), "file")
+			err := os.WriteFile(root, nil, 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cmd, cgroup := limitedCommand(root, "p1", &tt.config)
+			if cgroup != "" {
+				t.Errorf("cgroup = %q, want none", cgroup)
+			}
+			if strings.Join(cmd.Args, "|") != strings.Join(tt.wantArgs, "|") {
+				t.Errorf("args = %q, want %q", cmd.Args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestProcessMemoryRlimit(t *testing.T) {
+	p := NewProcess()
+	p.CgroupRoot = filepath.Join(t.TempDir(), "file")
+	err := os.WriteFile(p.CgroupRoot, nil, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The wrapper must hand the task's arguments over unchanged and keep
+	// its exit code.
+	id := startProcess(t, p, Config{
+		Cmd:    []string{"sh", "-c", `ulimit -v; echo "$1"; exit 3`, "sh", "two words"},
+		Memory: 64 << 20,
+	})
+	state := waitProcess(t, p, id)
+	if state.ExitCode != 3 {
+		t.Errorf("process exited with %d, want 3", state.ExitCode)
+	}
+	if got, want := processLogs(t, p, id), "65536\ntwo words\n"; got != want {
+		t.Errorf("logs = %q, want %q", got, want)
+	}
+}
+
+func TestCPUWeight(t *testing.T) {
+	tests := []struct {
+		cores float64
+		want  int64
+	}{
+		{cores: 0.001, want: 1},
+		{cores: 0.5, want: 50},
+		{cores: 1, want: 100},
+		{cores: 4, want: 400},
+		{cores: 200, want: 10000},
+	}
+	for _, tt := range tests {
+		if got := cpuWeight(tt.cores); got != tt.want {
+			t.Errorf("cpuWeight(%v) = %d, want %d", tt.cores, got, tt.want)
+		}
+	}
+}
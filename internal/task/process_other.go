@@ -0,0 +1,15 @@
+//go:build !linux
+
+package task
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+func limitedCommand(root string, name string, c *Config) (*exec.Cmd, string) {
+	if c.Memory > 0 || c.CPU > 0 || c.CPULimit > 0 {
+		fmt.Printf("Resource limits of %s are only supported on linux\n", name)
+	}
+	return exec.Command(c.Cmd[0], c.Cmd[1:]...), ""
+}
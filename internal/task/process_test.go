@@ -0,0 +1,171 @@
+package task
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startProcess runs cmd with p and returns its ID.
+func startProcess(t *testing.T, p *Process, c Config) string {
+	t.Helper()
+	_, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell to run test processes with")
+	}
+	id, err := p.Create(context.Background(), &c)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	err = p.Start(context.Background(), id)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	return id
+}
+
+// waitProcess waits for the process to exit and returns its final state.
+func waitProcess(t *testing.T, p *Process, id string) ContainerState {
+	t.Helper()
+	p.mu.Lock()
+	proc := p.procs[id]
+	p.mu.Unlock()
+	select {
+	case <-proc.done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("process %s did not exit", id)
+	}
+	state, err := p.Inspect(context.Background(), id)
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	return state
+}
+
+func processLogs(t *testing.T, p *Process, id string) string {
+	t.Helper()
+	r, err := p.Logs(context.Background(), id)
+	if err != nil {
+		t.Fatalf("Logs: %v", err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading logs: %v", err)
+	}
+	return string(out)
+}
+
+func TestProcessExit(t *testing.T) {
+	tests := []struct {
+		name      string
+		cmd       string
+		env       []string
+		wantCode  int
+		wantState State
+		wantLogs  string
+	}{
+		{name: "success", cmd: "echo hello", wantState: Completed, wantLogs: "hello\n"},
+		{name: "exit code", cmd: "echo failing >&2; exit 3", wantCode: 3, wantState: Failed, wantLogs: "failing\n"},
+		{name: "killed", cmd: "kill -KILL $$", wantCode: 137, wantState: Failed},
+		{
+			name: "environment", cmd: `echo "$GREETING"`, env: []string{"GREETING=hi"},
+			wantState: Completed, wantLogs: "hi\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProcess()
+			id := startProcess(t, p, Config{Cmd: []string{"sh", "-c", tt.cmd}, Env: tt.env})
+			state := waitProcess(t, p, id)
+			if state.Running || state.Status != "exited" {
+				t.Errorf("process is %q (running %v), want exited", state.Status, state.Running)
+			}
+			if state.ExitCode != tt.wantCode || state.TaskState() != tt.wantState {
+				t.Errorf("process exited with %d (%v), want %d (%v)",
+					state.ExitCode, state.TaskState(), tt.wantCode, tt.wantState)
+			}
+			if got := processLogs(t, p, id); got != tt.wantLogs {
+				t.Errorf("logs = %q, want %q", got, tt.wantLogs)
+			}
+			if state.FinishedAt.Before(state.StartedAt) {
+				t.Errorf("finished at %v, before starting at %v", state.FinishedAt, state.StartedAt)
+			}
+		})
+	}
+}
+
+func TestProcessStop(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  string
+		// timeout bounds how long Stop waits for the process to exit on
+		// SIGTERM before killing it.
+		timeout time.Duration
+		// ready waits for the process to print "ready" before stopping it,
+		// and exited for it to exit.
+		ready, exited bool
+		wantCode      int
+	}{
+		{name: "terminated", cmd: "exec sleep 60", timeout: 5 * time.Second, wantCode: 143},
+		{
+			name: "killed after ignoring SIGTERM", cmd: `trap "" TERM; echo ready; exec sleep 60`,
+			timeout: 200 * time.Millisecond, ready: true, wantCode: 137,
+		},
+		{name: "already exited", cmd: "exit 0", timeout: time.Second, exited: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProcess()
+			id := startProcess(t, p, Config{Cmd: []string{"sh", "-c", tt.cmd}})
+			if tt.ready {
+				deadline := time.Now().Add(5 * time.Second)
+				for !strings.Contains(processLogs(t, p, id), "ready") && time.Now().Before(deadline) {
+					time.Sleep(10 * time.Millisecond)
+				}
+			}
+			if tt.exited {
+				waitProcess(t, p, id)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			err := p.Stop(ctx, id)
+			if err != nil {
+				t.Fatalf("Stop: %v", err)
+			}
+			state := waitProcess(t, p, id)
+			if state.ExitCode != tt.wantCode {
+				t.Errorf("process exited with %d, want %d", state.ExitCode, tt.wantCode)
+			}
+
+			err = p.Remove(context.Background(), id)
+			if err != nil {
+				t.Fatalf("Remove: %v", err)
+			}
+			_, err = p.Inspect(context.Background(), id)
+			if err == nil {
+				t.Error("Inspect found a removed process")
+			}
+		})
+	}
+}
+
+func TestProcessRemoveRunning(t *testing.T) {
+	p := NewProcess()
+	id := startProcess(t, p, Config{Cmd: []string{"sh", "-c", "exec sleep 60"}})
+	defer func() {
+		_ = p.Stop(context.Background(), id)
+	}()
+
+	err := p.Remove(context.Background(), id)
+	if err == nil {
+		t.Fatal("Remove of a running process succeeded")
+	}
+	state, err := p.Inspect(context.Background(), id)
+	if err != nil || !state.Running {
+		t.Errorf("process is %+v (%v), want it still running", state, err)
+	}
+}
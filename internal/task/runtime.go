@@ -0,0 +1,142 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	DockerRuntime  = "docker"
+	FakeRuntime    = "fake"
+	ProcessRuntime = "process"
+)
+
+// Runtime is the container engine a worker runs its tasks with.
+type Runtime interface {
+	Pull(ctx context.Context, image string) error
+	Create(ctx context.Context, c *Config) (string, error)
+	Start(ctx context.Context, containerID string) error
+	Stop(ctx context.Context, containerID string) error
+	Remove(ctx context.Context, containerID string) error
+	Inspect(ctx context.Context, containerID string) (ContainerState, error)
+	Logs(ctx context.Context, containerID string) (io.ReadCloser, error)
+	// List returns every container, running or not, that carries all of the
+	// given labels.
+	List(ctx context.Context, labels map[string]string) ([]ContainerState, error)
+	// Exec runs cmd inside the container and returns its exit code.
+	Exec(ctx context.Context, containerID string, cmd []string) (int, error)
+}
+
+// ContainerState is the runtime's view of a single container.
+type ContainerState struct {
+	ID     string
+	Name   string
+	Labels map[string]string
+	// Ports maps the container's ports, such as "80/tcp", to the host ports
+	// they are published on.
+	Ports      map[string]string
+	Status     string
+	Running    bool
+	ExitCode   int
+	Error      string
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// TaskState maps the container's state onto the task states the worker
+// tracks: a container that is still up is Running, one that exited cleanly
+// is Completed and anything else is Failed.
+func (cs ContainerState) TaskState() State {
+	switch {
+	case cs.Running:
+		return Running
+	case cs.Status == "created":
+		return Scheduled
+	case cs.Status == "exited" && cs.ExitCode == 0 && cs.Error == "":
+		return Completed
+	default:
+		return Failed
+	}
+}
+
+// NewRuntime returns the runtime registered under name.
+func NewRuntime(name string) (Runtime, error) {
+	switch name {
+	case DockerRuntime, "":
+		return NewDocker()
+	case FakeRuntime:
+		return NewFake(), nil
+	case ProcessRuntime:
+		return NewProcess(), nil
+	default:
+		return nil, fmt.Errorf("unknown runtime %q", name)
+	}
+}
+
+// Run pulls the configured image, then creates and starts a container for it
+// on the given runtime.
+func Run(ctx context.Context, rt Runtime, c *Config) DockerResult {
+	err := rt.Pull(ctx, c.Image)
+	if err != nil {
+		fmt.Printf("Error pulling image %s: %v\n", c.Image, err)
+		return DockerResult{Error: err}
+	}
+
+	containerID, err := rt.Create(ctx, c)
+	if err != nil {
+		fmt.Printf("Error creating container using image %s: %v\n", c.Image, err)
+		return DockerResult{Error: err}
+	}
+
+	err = rt.Start(ctx, containerID)
+	if err != nil {
+		fmt.Printf("Error starting container %s: %v\n", containerID, err)
+		return DockerResult{Error: err, ContainerID: containerID}
+	}
+
+	out, err := rt.Logs(ctx, containerID)
+	if err != nil {
+		fmt.Printf("Error getting logs for container %s: %v\n", containerID, err)
+		return DockerResult{Error: err, ContainerID: containerID}
+	}
+	defer out.Close()
+	_, err = io.Copy(os.Stdout, out)
+	if err != nil {
+		fmt.Printf("Error getting logs for container %s: %v\n", containerID, err)
+		return DockerResult{Error: err, ContainerID: containerID}
+	}
+
+	return DockerResult{
+		ContainerID: containerID,
+		Action:      "start",
+		Result:      "success",
+	}
+}
+
+// Stop stops and removes the container on the given runtime.
+func Stop(ctx context.Context, rt Runtime, containerID string) DockerResult {
+	fmt.Printf("Attempting to stop container %v\n", containerID)
+	err := rt.Stop(ctx, containerID)
+	if err != nil {
+		return DockerResult{Action: "stop", ContainerID: containerID, Error: err}
+	}
+
+	err = rt.Remove(ctx, containerID)
+	if err != nil {
+		return DockerResult{Action: "stop", ContainerID: containerID, Error: err}
+	}
+	return DockerResult{Action: "stop", ContainerID: containerID, Result: "success", Error: nil}
+}
+
+// hasLabels reports whether labels contains every key/value pair in want.
+func hasLabels(labels map[string]string, want map[string]string) bool {
+	for k, v := range want {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package task
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Service keeps Replicas copies of its task template running. The manager
+// starts a new task from the template whenever one finishes or fails, and
+// stops tasks when the service is scaled down.
+type Service struct {
+	ID        uuid.UUID
+	Name      string
+	Replicas  int
+	Template  Task
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	// Revision numbers the versions of the template. It goes up each time
+	// the template is changed, and tasks record the revision they were
+	// started from. PreviousTemplate is the template in use before the last
+	// change, which a rollback returns to.
+	Revision         int
+	PreviousTemplate *Task `json:",omitempty"`
+	PreviousRevision int   `json:",omitempty"`
+
+	// Update controls how tasks are replaced when the template changes, and
+	// UpdateStatus reports the progress of the latest update.
+	Update       UpdateConfig
+	UpdateStatus *UpdateStatus `json:",omitempty"`
+
+	// Running and Tasks are filled in from the service's unfinished tasks
+	// when the service is read; they are not stored.
+	Running int     `json:",omitempty"`
+	Tasks   []*Task `json:",omitempty"`
+}
+
+const (
+	// UpdateRollback rolls an update back when it fails.
+	UpdateRollback = "rollback"
+	// UpdatePause stops an update where it is when it fails.
+	UpdatePause = "pause"
+)
+
+// UpdateConfig is a service's rolling update strategy. Tasks are replaced in
+// batches: up to MaxSurge tasks more than Replicas may run during the
+// update, and up to MaxUnavailable fewer may be ready. The next batch starts
+// once every new task has been running and healthy for Monitor and Delay has
+// passed. A batch fails if a new task fails or turns unhealthy, or if its
+// tasks are not all healthy within Timeout; FailureAction then decides
+// whether the update is rolled back or paused.
+type UpdateConfig struct {
+	MaxSurge       int
+	MaxUnavailable int
+	Delay          time.Duration
+	Monitor        time.Duration
+	Timeout        time.Duration
+	FailureAction  string
+}
+
+const (
+	DefaultUpdateMonitor = 5 * time.Second
+	DefaultUpdateTimeout = 2 * time.Minute
+)
+
+// DefaultUpdateConfig replaces one task at a time, starting its replacement
+// before stopping it.
+func DefaultUpdateConfig() UpdateConfig {
+	return UpdateConfig{
+		MaxSurge:      1,
+		Monitor:       DefaultUpdateMonitor,
+		Timeout:       DefaultUpdateTimeout,
+		FailureAction: UpdateRollback,
+	}
+}
+
+// UpdateState is the progress of a service update.
+type UpdateState string
+
+const (
+	UpdateInProgress  UpdateState = "updating"
+	UpdateCompleted   UpdateState = "completed"
+	UpdatePaused      UpdateState = "paused"
+	UpdateRollingBack UpdateState = "rolling_back"
+	UpdateRolledBack  UpdateState = "rolled_back"
+)
+
+// UpdateStatus reports how far a service update has got. Updated is the
+// number of replicas running the target revision and ready. Message says
+// what the update is waiting for, and Reason why it was rolled back or
+// paused.
+type UpdateStatus struct {
+	State          UpdateState
+	StartedAt      time.Time
+	CompletedAt    time.Time
+	BatchStartedAt time.Time
+	Updated        int
+	Message        string `json:",omitempty"`
+	Reason         string `json:",omitempty"`
+}
+
+// Active reports whether the update is still replacing tasks.
+func (s *UpdateStatus) Active() bool {
+	return s != nil && (s.State == UpdateInProgress || s.State == UpdateRollingBack)
+}
+
+// Active reports whether the task still counts towards a service's
+// replicas, that is whether it is running or about to.
+func (t *Task) Active() bool {
+	return t.State != Completed && t.State != Failed
+}
+
+// Ready reports whether the task is running and, if it has a health check,
+// has passed it.
+func (t *Task) Ready() bool {
+	return t.State == Running && (t.HealthCheck == nil || t.Health == Healthy)
+}
@@ -1,16 +1,8 @@
 package task
 
 import (
-	"context"
-	"fmt"
-	"io"
-	"os"
 	"time"
 
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/client"
-	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 	"github.com/google/uuid"
 )
@@ -23,10 +15,14 @@ const (
 	Completed
 	Running
 	Failed
+	// Waiting is a job task held back by the manager until the tasks it
+	// depends on are far enough along.
+	Waiting
 )
 
 var stateTransitionMap = map[State][]State{
 	Pending:   {Scheduled},
+	Waiting:   {Pending},
 	Scheduled: {Scheduled, Running, Failed},
 	Running:   {Running, Completed, Failed},
 	Completed: {},
@@ -47,24 +43,77 @@ func ValidStateTransition(src State, dst State) bool {
 }
 
 type Task struct {
-	ID            uuid.UUID
-	Name          string
-	State         State
-	Image         string
-	Memory        int64
-	Disk          int64
+	ID   uuid.UUID
+	Name string
+	// JobID is the job the task belongs to, if it was submitted as part of
+	// one. A job task that fails is started again as a new task until it
+	// has been retried MaxRetries times; Attempt counts the retries so far.
+	JobID      uuid.UUID
+	MaxRetries int `json:",omitempty"`
+	Attempt    int `json:",omitempty"`
+	// DependsOn lists the tasks of the same job that must reach a condition
+	// before the task is scheduled. Reason says what a waiting task is
+	// waiting for, why a pending task has not been placed on a worker, or
+	// why a task failed without running.
+	DependsOn []Dependency `json:",omitempty"`
+	Reason    string       `json:",omitempty"`
+	// ServiceID is the service the task is a replica of, if any, and
+	// Revision the version of the service's template it was started from.
+	ServiceID uuid.UUID
+	Revision  int `json:",omitempty"`
+	// Tenant is the team or namespace the task was submitted by. Pending
+	// tasks are dispatched fairly across tenants.
+	Tenant string `json:",omitempty"`
+	// PriorityClass names the task's priority and Priority is its value.
+	// PreemptionPolicy says whether the task may preempt tasks of a lower
+	// priority when it can't be placed.
+	PriorityClass    string `json:",omitempty"`
+	Priority         int    `json:",omitempty"`
+	PreemptionPolicy string `json:",omitempty"`
+	State            State
+	Image            string
+	Cmd              []string
+	Env              []string
+	Memory           int64
+	Disk             int64
+	// CPU is the number of cores the task asks for, which is reserved on
+	// the node it is placed on, and CPULimit the most it may use. Zero means
+	// no request or no limit.
+	CPU           float64 `json:",omitempty"`
+	CPULimit      float64 `json:",omitempty"`
 	ExposedPorts  nat.PortSet
 	PortBindings  map[string]string
 	RestartPolicy string
-	StartTime     time.Time
-	FinishTime    time.Time
-	ContainerID   string
+	MaxRestarts   int
+	HealthCheck   *HealthCheck
+	Constraints   []Constraint
+	Preferences   []Preference `json:",omitempty"`
+	// Labels describe the task to the affinity rules of other tasks.
+	// Affinity and AntiAffinity place the task on nodes that run, or don't
+	// run, tasks whose labels match their selectors.
+	Labels       map[string]string `json:",omitempty"`
+	Affinity     []AffinityRule    `json:",omitempty"`
+	AntiAffinity []AffinityRule    `json:",omitempty"`
+	// TopologySpread spreads the task and others like it across nodes
+	// grouped by a label.
+	TopologySpread []SpreadRule `json:",omitempty"`
+	Health         string
+	Restarts       []Restart
+	StartTime      time.Time
+	FinishTime     time.Time
+	// ExitCode is the exit code of the task's container once it has
+	// finished. Stopped is set when the manager stops the task, on request
+	// or to preempt it, so that its finishing doesn't count as completing.
+	ExitCode    int
+	Stopped     bool `json:",omitempty"`
+	ContainerID string
 }
 type TaskEvent struct {
 	ID        uuid.UUID
 	State     State
 	Timestamp time.Time
 	Task      Task
+	Reason    string
 }
 
 type Config struct {
@@ -76,14 +125,16 @@ type Config struct {
 	Image         string
 	Memory        int64
 	Disk          int64
+	CPU           float64
+	CPULimit      float64
 	Env           []string
+	Labels        map[string]string
 	RestartPolicy string
-}
-
-type Docker struct {
-	Client      *client.Client
-	Config      Config
-	ContainerID string
+	// ExposedPorts are the container ports to publish, and PortBindings
+	// the host ports some of them are published on, such as "80/tcp" to
+	// "8080". Ports without a binding are published on a random host port.
+	ExposedPorts nat.PortSet
+	PortBindings map[string]string
 }
 
 type DockerResult struct {
@@ -95,120 +146,16 @@ type DockerResult struct {
 
 func NewConfig(t *Task) *Config {
 	return &Config{
-		Name:   t.Name,
-		Image:  t.Image,
-		Memory: t.Memory,
-		Disk:   t.Disk,
-	}
-}
-
-func NewDocker(c *Config) *Docker {
-	cli, err := client.NewClientWithOpts(
-		client.FromEnv,
-		client.WithAPIVersionNegotiation(),
-	)
-	if err != nil {
-		panic(err)
-	}
-	return &Docker{
-		Client:      cli,
-		Config:      *c,
-		ContainerID: c.Name,
-	}
-}
-
-//nolint:funlen
-func (d *Docker) Run() DockerResult {
-	// Pull Image
-	ctx := context.Background()
-	reader, err := d.Client.ImagePull(
-		ctx, d.Config.Image, types.ImagePullOptions{})
-	if err != nil {
-		fmt.Printf("Error pulling image %s: %v\n", d.Config.Image, err)
-		return DockerResult{Error: err}
-	}
-	_, err = io.Copy(os.Stdout, reader)
-	if err != nil {
-		fmt.Printf("Error pulling image %s: %v\n", d.Config.Image, err)
-		return DockerResult{Error: err}
-	}
-
-	// Create Container
-	rp := container.RestartPolicy{
-		Name: d.Config.RestartPolicy,
-	}
-	r := container.Resources{
-		Memory: d.Config.Memory,
-	}
-	cc := container.Config{
-		Image: d.Config.Image,
-		Env:   d.Config.Env,
-	}
-	hc := container.HostConfig{
-		RestartPolicy:   rp,
-		Resources:       r,
-		PublishAllPorts: true,
-	}
-
-	resp, err := d.Client.ContainerCreate(
-		ctx, &cc, &hc, nil, nil, d.Config.Name)
-	if err != nil {
-		fmt.Printf("Error creating container using image %s: %v\n", d.Config.Image, err)
-		return DockerResult{Error: err}
-	}
-
-	// start container
-	err2 := d.Client.ContainerStart(
-		ctx, resp.ID, types.ContainerStartOptions{})
-	if err2 != nil {
-		fmt.Printf("Erroßr starting container %s: %v\n", resp.ID, err2)
-		return DockerResult{Error: err2}
-	}
-
-	d.ContainerID = resp.ID
-	out, err := d.Client.ContainerLogs(
-		ctx,
-		resp.ID,
-		types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true},
-	)
-	if err != nil {
-		fmt.Printf("Error getting logs for container %s: %v\n", resp.ID, err)
-		return DockerResult{Error: err}
-	}
-	_, err = stdcopy.StdCopy(os.Stdout, os.Stderr, out)
-	if err != nil {
-		fmt.Printf("Error getting logs for container %s: %v\n", resp.ID, err)
-		return DockerResult{Error: err}
-	}
-	return DockerResult{
-		ContainerID: resp.ID,
-		Action:      "start",
-		Result:      "success",
-	}
-}
-
-func (d *Docker) Stop() DockerResult {
-	ctx := context.Background()
-	fmt.Printf(
-		"Attempting to stop container %v", d.ContainerID)
-	err := d.Client.ContainerStop(ctx, d.ContainerID, nil)
-	if err != nil {
-		panic(err)
-	}
-
-	removeOptions := types.ContainerRemoveOptions{
-		RemoveVolumes: true,
-		RemoveLinks:   false,
-		Force:         false,
-	}
-
-	err = d.Client.ContainerRemove(
-		ctx,
-		d.ContainerID,
-		removeOptions,
-	)
-	if err != nil {
-		panic(err)
+		Name:          t.Name,
+		Image:         t.Image,
+		Cmd:           t.Cmd,
+		Env:           t.Env,
+		Memory:        t.Memory,
+		Disk:          t.Disk,
+		CPU:           t.CPU,
+		CPULimit:      t.CPULimit,
+		RestartPolicy: t.RestartPolicy,
+		ExposedPorts:  t.ExposedPorts,
+		PortBindings:  t.PortBindings,
 	}
-	return DockerResult{Action: "stop", Result: "success", Error: nil}
 }
@@ -0,0 +1,21 @@
+package task
+
+import "time"
+
+// DefaultTenant is the tenant of tasks submitted without one.
+const DefaultTenant = "default"
+
+// TenantQueue reports on a tenant's share of the manager's pending queue.
+// Weight is the tenant's share of dispatches relative to other tenants
+// with pending work, Pending the number of events it has queued and
+// OldestWait how long the oldest of them has waited. Dispatched counts the
+// tasks of the tenant sent to workers since the manager started, and
+// AverageWait is how long they waited on average from submission.
+type TenantQueue struct {
+	Tenant      string
+	Weight      int
+	Pending     int
+	OldestWait  time.Duration
+	Dispatched  int
+	AverageWait time.Duration
+}
@@ -3,6 +3,7 @@ package worker
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/elimt/go-orchestrator/internal/task"
@@ -38,6 +39,7 @@ func (a *API) initRouter() {
 		r.Get("/", a.GetTasksHandler)
 		r.Route("/{taskID}", func(r chi.Router) {
 			r.Delete("/", a.StopTaskHandler)
+			r.Get("/logs", a.GetTaskLogsHandler)
 		})
 	})
 	a.Router.Route("/stats", func(r chi.Router) {
@@ -89,16 +91,17 @@ func (a *API) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
 	if taskID == "" {
 		fmt.Printf("No taskID passed in request.\n")
 		w.WriteHeader(400)
+		return
 	}
 
 	tID, _ := uuid.Parse(taskID)
-	_, ok := a.Worker.DB[tID]
-	if !ok {
-		fmt.Printf("No task with ID %v found", tID)
+	taskToStop, err := a.Worker.getTask(tID)
+	if err != nil {
+		fmt.Printf("No task with ID %v found\n", tID)
 		w.WriteHeader(404)
+		return
 	}
 
-	taskToStop := a.Worker.DB[tID]
 	taskCopy := *taskToStop
 	taskCopy.State = task.Completed
 	a.Worker.AddTask(taskCopy)
@@ -110,8 +113,39 @@ func (a *API) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
 func (a *API) GetStatsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(200)
-	err := json.NewEncoder(w).Encode(a.Worker.Stats)
+	err := json.NewEncoder(w).Encode(a.Worker.GetStats())
 	if err != nil {
 		fmt.Printf("Error encoding error response: %v\n", err)
 	}
 }
+
+func (a *API) GetTaskLogsHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := chi.URLParam(r, "taskID")
+	tID, err := uuid.Parse(taskID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	logs, err := a.Worker.Logs(r.Context(), tID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		e := ErrResponse{
+			HTTPStatusCode: http.StatusNotFound,
+			Message:        err.Error(),
+		}
+		err = json.NewEncoder(w).Encode(e)
+		if err != nil {
+			fmt.Printf("Error encoding error response: %v\n", err)
+		}
+		return
+	}
+	defer logs.Close()
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	_, err = io.Copy(w, logs)
+	if err != nil {
+		fmt.Printf("Error streaming logs for task %v: %v\n", tID, err)
+	}
+}
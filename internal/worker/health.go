@@ -0,0 +1,239 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/elimt/go-orchestrator/internal/task"
+	"github.com/google/uuid"
+)
+
+const (
+	// restartBackoff is the delay before a task's second restart. It doubles
+	// with every further restart up to maxRestartBackoff.
+	restartBackoff    = 5 * time.Second
+	maxRestartBackoff = 5 * time.Minute
+)
+
+// healthState tracks the health checks of a single task between runs.
+type healthState struct {
+	lastCheck time.Time
+	failures  int
+}
+
+// CheckHealth runs the health checks of running tasks as they come due and
+// restarts tasks that keep failing them.
+func (w *Worker) CheckHealth() {
+	for {
+		w.checkHealth()
+		time.Sleep(1 * time.Second)
+	}
+}
+
+func (w *Worker) checkHealth() {
+	if w.health == nil {
+		w.health = make(map[uuid.UUID]*healthState)
+	}
+
+	now := time.Now().UTC()
+	for _, t := range w.GetTasks() {
+		if t.State != task.Running || t.HealthCheck == nil {
+			delete(w.health, t.ID)
+			continue
+		}
+
+		hs, ok := w.health[t.ID]
+		if !ok {
+			hs = &healthState{lastCheck: t.StartTime}
+			w.health[t.ID] = hs
+		}
+		if now.Sub(hs.lastCheck) < t.HealthCheck.GetInterval() {
+			continue
+		}
+		hs.lastCheck = now
+
+		err := w.runHealthCheck(t)
+		if err == nil {
+			hs.failures = 0
+			w.setHealth(t, task.Healthy)
+			continue
+		}
+
+		hs.failures++
+		fmt.Printf("Health check %d/%d for task %v failed: %v\n",
+			hs.failures, t.HealthCheck.GetRetries(), t.ID, err)
+		if hs.failures < t.HealthCheck.GetRetries() {
+			continue
+		}
+
+		if !w.setHealth(t, task.Unhealthy) {
+			delete(w.health, t.ID)
+			continue
+		}
+		reason := fmt.Sprintf("%s health check failed %d times: %v", t.HealthCheck.Type, hs.failures, err)
+		if w.restartTask(t, reason) {
+			hs.failures = 0
+			hs.lastCheck = time.Now().UTC()
+		}
+	}
+}
+
+// setHealth records the health of task t, which was read before its check
+// ran, unless the task has since finished or had its container replaced.
+// It reports whether the task is still running in the checked container,
+// and updates t to the stored task if so.
+func (w *Worker) setHealth(t *task.Task, health string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	current, err := w.getTask(t.ID)
+	if err != nil || current.State != task.Running || current.ContainerID != t.ContainerID {
+		return false
+	}
+	if current.Health != health {
+		current.Health = health
+		w.putTask(current)
+	}
+	*t = *current
+	return true
+}
+
+func (w *Worker) runHealthCheck(t *task.Task) error {
+	hc := t.HealthCheck
+	ctx, cancel := context.WithTimeout(context.Background(), hc.GetTimeout())
+	defer cancel()
+
+	switch hc.Type {
+	case task.HTTPHealthCheck:
+		url := fmt.Sprintf("http://%s%s", w.healthCheckAddress(ctx, t), hc.Path)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+			return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+		}
+		return nil
+	case task.TCPHealthCheck:
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", w.healthCheckAddress(ctx, t))
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case task.ExecHealthCheck:
+		code, err := w.Runtime.Exec(ctx, t.ContainerID, hc.Command)
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			return fmt.Errorf("command exited with code %d", code)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown health check type %q", hc.Type)
+	}
+}
+
+// healthCheckAddress returns the host:port to check, using the host port the
+// task's port is published on when the runtime reports one.
+func (w *Worker) healthCheckAddress(ctx context.Context, t *task.Task) string {
+	host := t.HealthCheck.Host
+	if host == "" {
+		host = "localhost"
+	}
+	port := strconv.Itoa(t.HealthCheck.Port)
+
+	cs, err := w.Runtime.Inspect(ctx, t.ContainerID)
+	if err == nil {
+		if hostPort, ok := cs.Ports[port+"/tcp"]; ok {
+			port = hostPort
+		}
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// restartDue reports whether the task has waited out the backoff since its
+// last restart, which doubles with each restart up to maxRestartBackoff.
+func restartDue(t *task.Task) bool {
+	n := len(t.Restarts)
+	if n == 0 {
+		return true
+	}
+	wait := restartBackoff << (n - 1)
+	if wait > maxRestartBackoff || wait <= 0 {
+		wait = maxRestartBackoff
+	}
+	return time.Since(t.Restarts[n-1].Timestamp) >= wait
+}
+
+// restartTask replaces an unhealthy task's container with a new one and
+// records why. A task without restarts left is stopped and marked failed. It
+// reports whether the task was restarted.
+func (w *Worker) restartTask(t *task.Task, reason string) bool {
+	if t.RestartPolicy == "" || t.RestartPolicy == "no" {
+		return false
+	}
+
+	w.mu.Lock()
+	ctx, ok := w.beginOperation(t.ID)
+	w.mu.Unlock()
+	if !ok {
+		return false
+	}
+	defer w.finishOperation(t.ID)
+
+	// The task may have been stopped while its health was being checked.
+	current, err := w.getTask(t.ID)
+	if err != nil || current.State != task.Running || current.ContainerID != t.ContainerID {
+		return false
+	}
+
+	if !t.CanRestart() {
+		fmt.Printf("Task %v has used all %d restarts, stopping it\n", t.ID, t.MaxRestarts)
+		result := task.Stop(ctx, w.Runtime, t.ContainerID)
+		if result.Error != nil {
+			fmt.Printf("Error stopping container %v: %v\n", t.ContainerID, result.Error)
+		}
+		t.State = task.Failed
+		w.finishTask(t)
+		return false
+	}
+
+	if !restartDue(t) {
+		return false
+	}
+
+	fmt.Printf("Restarting task %v: %s\n", t.ID, reason)
+	result := task.Stop(ctx, w.Runtime, t.ContainerID)
+	if result.Error != nil {
+		fmt.Printf("Error stopping container %v: %v\n", t.ContainerID, result.Error)
+	}
+
+	t.Restarts = append(t.Restarts, task.Restart{Timestamp: time.Now().UTC(), Reason: reason})
+	t.Health = ""
+
+	config := task.NewConfig(t)
+	config.Labels = w.containerLabels(*t)
+	result = task.Run(ctx, w.Runtime, config)
+	if result.Error != nil {
+		fmt.Printf("Error restarting task %v: %v\n", t.ID, result.Error)
+		t.State = task.Failed
+		w.finishTask(t)
+		return false
+	}
+
+	t.ContainerID = result.ContainerID
+	t.StartTime = time.Now().UTC()
+	w.putTask(t)
+	return true
+}
@@ -0,0 +1,80 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elimt/go-orchestrator/internal/store"
+	"github.com/elimt/go-orchestrator/internal/task"
+	"github.com/google/uuid"
+)
+
+func TestCheckHealthRecordsOnlyRunningTasks(t *testing.T) {
+	tests := []struct {
+		name string
+		// fail fails the check, and stop finishes the task while it runs.
+		fail, stop   bool
+		wantState    task.State
+		wantHealth   string
+		wantRestarts int
+	}{
+		{name: "passes", wantState: task.Running, wantHealth: task.Healthy},
+		{name: "fails", fail: true, wantState: task.Running, wantRestarts: 1},
+		{name: "stopped while passing", stop: true, wantState: task.Completed},
+		{name: "stopped while failing", fail: true, stop: true, wantState: task.Completed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := task.NewFake()
+			w, err := New("w1", rt, store.MemoryType, "")
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			tk := task.Task{
+				ID:            uuid.New(),
+				Name:          "web",
+				Image:         "alpine",
+				State:         task.Scheduled,
+				RestartPolicy: "always",
+				HealthCheck:   &task.HealthCheck{Type: task.ExecHealthCheck, Interval: time.Nanosecond, Retries: 1},
+			}
+			if result := w.StartTask(context.Background(), tk); result.Error != nil {
+				t.Fatalf("StartTask: %v", result.Error)
+			}
+
+			rt.Failure = func(op string, image string) error {
+				if op != "exec" {
+					return nil
+				}
+				if tt.stop {
+					stopped, err := w.getTask(tk.ID)
+					if err != nil {
+						t.Errorf("getting task: %v", err)
+						return nil
+					}
+					stopped.State = task.Completed
+					w.finishTask(stopped)
+				}
+				if tt.fail {
+					return errors.New("check failed")
+				}
+				return nil
+			}
+			w.checkHealth()
+
+			got, err := w.getTask(tk.ID)
+			if err != nil {
+				t.Fatalf("getting task: %v", err)
+			}
+			if got.State != tt.wantState || got.Health != tt.wantHealth {
+				t.Errorf("task is %v with health %q, want %v with %q",
+					got.State, got.Health, tt.wantState, tt.wantHealth)
+			}
+			if len(got.Restarts) != tt.wantRestarts {
+				t.Errorf("task was restarted %d times, want %d", len(got.Restarts), tt.wantRestarts)
+			}
+		})
+	}
+}
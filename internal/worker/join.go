@@ -0,0 +1,107 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/elimt/go-orchestrator/internal/node"
+	"github.com/elimt/go-orchestrator/internal/stats"
+)
+
+// Join registers the worker with the manager listening at managerAPI and then
+// sends a heartbeat every interval. If the manager no longer knows about the
+// worker, for example after a manager restart, the worker registers again.
+func (w *Worker) Join(managerAPI string, api string, interval time.Duration) {
+	registered := false
+	for {
+		var err error
+		if registered {
+			err = w.heartbeat(managerAPI)
+			if err != nil {
+				fmt.Printf("Error sending heartbeat to %v: %v\n", managerAPI, err)
+				registered = false
+			}
+		}
+		if !registered {
+			err = w.register(managerAPI, api)
+			if err != nil {
+				fmt.Printf("Error registering with manager %v: %v\n", managerAPI, err)
+			} else {
+				fmt.Printf("Registered worker %v with manager %v\n", w.Name, managerAPI)
+				registered = true
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Node describes the worker, its capacity and its labels to the manager.
+// The arch and os labels are set from the platform unless the worker was
+// given them.
+func (w *Worker) Node(api string) node.Node {
+	s := stats.GetStats()
+	n := node.NewNode(w.Name, api, "worker")
+	n.Memory = int(s.MemTotalKb())
+	n.Disk = int(s.DiskTotal())
+	n.Cores = runtime.NumCPU()
+	n.Labels = map[string]string{
+		"arch": runtime.GOARCH,
+		"os":   runtime.GOOS,
+	}
+	for k, v := range w.Labels {
+		n.Labels[k] = v
+	}
+	return *n
+}
+
+func (w *Worker) register(managerAPI string, api string) error {
+	data, err := json.Marshal(w.Node(api))
+	if err != nil {
+		return fmt.Errorf("unable to marshal node: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/nodes", managerAPI)
+	//nolint:gosec
+	resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return decodeErrResponse(resp)
+	}
+	return nil
+}
+
+func (w *Worker) heartbeat(managerAPI string) error {
+	url := fmt.Sprintf("%s/nodes/%s/heartbeat", managerAPI, w.Name)
+	req, err := http.NewRequest(http.MethodPut, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return decodeErrResponse(resp)
+	}
+	return nil
+}
+
+func decodeErrResponse(resp *http.Response) error {
+	e := ErrResponse{}
+	err := json.NewDecoder(resp.Body).Decode(&e)
+	if err != nil {
+		return fmt.Errorf("unexpected status %d from manager", resp.StatusCode)
+	}
+	return fmt.Errorf("response error (%d): %s", e.HTTPStatusCode, e.Message)
+}
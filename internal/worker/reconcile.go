@@ -0,0 +1,150 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/elimt/go-orchestrator/internal/task"
+	"github.com/google/uuid"
+)
+
+// Labels set on every container the worker creates, so it can find its
+// containers again after a restart.
+const (
+	WorkerLabel   = "go-orchestrator.worker"
+	TaskLabel     = "go-orchestrator.task"
+	TaskSpecLabel = "go-orchestrator.task-spec"
+)
+
+// Reconciliation describes what Reconcile changed.
+type Reconciliation struct {
+	// Recovered are tasks missing from the store that were rebuilt from
+	// their containers.
+	Recovered []uuid.UUID
+	// Updated are known tasks whose container or state was corrected.
+	Updated []uuid.UUID
+	// Lost are tasks recorded as running whose container no longer exists.
+	Lost []uuid.UUID
+	// Orphans are containers that were stopped and removed because they no
+	// longer belong to a task.
+	Orphans []string
+}
+
+func (r Reconciliation) String() string {
+	return fmt.Sprintf("%d recovered, %d updated, %d lost, %d orphaned containers removed",
+		len(r.Recovered), len(r.Updated), len(r.Lost), len(r.Orphans))
+}
+
+// containerLabels returns the labels identifying t's container as belonging
+// to this worker.
+func (w *Worker) containerLabels(t task.Task) map[string]string {
+	labels := map[string]string{
+		WorkerLabel: w.Name,
+		TaskLabel:   t.ID.String(),
+	}
+	spec, err := json.Marshal(t)
+	if err == nil {
+		labels[TaskSpecLabel] = string(spec)
+	}
+	return labels
+}
+
+// Reconcile brings the worker's store in line with the containers the
+// runtime is actually running for it. It should be called on startup, before
+// the worker begins processing tasks.
+func (w *Worker) Reconcile(ctx context.Context) (Reconciliation, error) {
+	var r Reconciliation
+
+	containers, err := w.Runtime.List(ctx, map[string]string{WorkerLabel: w.Name})
+	if err != nil {
+		return r, fmt.Errorf("error listing containers: %w", err)
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	for _, c := range containers {
+		w.reconcileContainer(ctx, c, seen, &r)
+	}
+
+	for _, t := range w.GetTasks() {
+		if seen[t.ID] || (t.State != task.Running && t.State != task.Scheduled) {
+			continue
+		}
+		fmt.Printf("Container %v for task %v no longer exists\n", t.ContainerID, t.ID)
+		t.State = task.Failed
+		w.putTask(t)
+		r.Lost = append(r.Lost, t.ID)
+	}
+
+	running := 0
+	for _, t := range w.GetTasks() {
+		if t.State == task.Running {
+			running++
+		}
+	}
+	w.mu.Lock()
+	w.TaskCount = running
+	w.mu.Unlock()
+
+	fmt.Printf("Reconciled worker %v: %v\n", w.Name, r)
+	return r, nil
+}
+
+// reconcileContainer brings the task of container c in line with it, adding
+// what it did to r. seen collects the tasks whose containers were found.
+func (w *Worker) reconcileContainer(ctx context.Context, c task.ContainerState, seen map[uuid.UUID]bool,
+	r *Reconciliation) {
+	id, err := uuid.Parse(c.Labels[TaskLabel])
+	if err != nil || seen[id] {
+		r.Orphans = append(r.Orphans, w.removeOrphan(ctx, c))
+		return
+	}
+
+	state := c.TaskState()
+	t, err := w.getTask(id)
+	switch {
+	case err != nil:
+		t = &task.Task{}
+		err = json.Unmarshal([]byte(c.Labels[TaskSpecLabel]), t)
+		if err != nil || t.ID != id || state == task.Scheduled {
+			r.Orphans = append(r.Orphans, w.removeOrphan(ctx, c))
+			return
+		}
+		r.Recovered = append(r.Recovered, id)
+	case t.State == task.Completed || t.State == task.Failed:
+		if c.Running {
+			r.Orphans = append(r.Orphans, w.removeOrphan(ctx, c))
+		}
+		seen[id] = true
+		return
+	case state == task.Scheduled:
+		// The container was created but never started.
+		r.Orphans = append(r.Orphans, w.removeOrphan(ctx, c))
+		return
+	default:
+		if t.ContainerID == c.ID && t.State == state {
+			seen[id] = true
+			return
+		}
+		r.Updated = append(r.Updated, id)
+	}
+
+	seen[id] = true
+	t.ContainerID = c.ID
+	t.State = state
+	t.StartTime = c.StartedAt
+	if state != task.Running {
+		t.FinishTime = c.FinishedAt
+		t.ExitCode = c.ExitCode
+	}
+	w.putTask(t)
+}
+
+func (w *Worker) removeOrphan(ctx context.Context, c task.ContainerState) string {
+	fmt.Printf("Removing orphaned container %v\n", c.ID)
+	result := task.Stop(ctx, w.Runtime, c.ID)
+	if result.Error != nil {
+		fmt.Printf("Error removing orphaned container %v: %v\n", c.ID, result.Error)
+	}
+	return c.ID
+}
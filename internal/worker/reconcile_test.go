@@ -0,0 +1,235 @@
+package worker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/elimt/go-orchestrator/internal/store"
+	"github.com/elimt/go-orchestrator/internal/task"
+	"github.com/google/uuid"
+)
+
+// reconcileFixture seeds a worker's store and its Fake runtime with tasks
+// and containers, referring to tasks by name.
+type reconcileFixture struct {
+	t     *testing.T
+	w     *Worker
+	rt    *task.Fake
+	tasks map[string]*task.Task
+}
+
+func (f *reconcileFixture) task(name string) *task.Task {
+	tk, ok := f.tasks[name]
+	if !ok {
+		tk = &task.Task{ID: uuid.New(), Name: name, Image: "alpine"}
+		f.tasks[name] = tk
+	}
+	return tk
+}
+
+// store records the named task in the worker's store.
+func (f *reconcileFixture) store(name string, state task.State, containerID string) {
+	tk := f.task(name)
+	tk.State = state
+	tk.ContainerID = containerID
+	f.w.putTask(tk)
+}
+
+// container creates a container for the named task labelled as the worker
+// labels them, leaves it "created", "running" or "exited" with code, and
+// returns its ID.
+func (f *reconcileFixture) container(name string, status string, code int) string {
+	return f.labelled(f.w.containerLabels(*f.task(name)), status, code)
+}
+
+func (f *reconcileFixture) labelled(labels map[string]string, status string, code int) string {
+	f.t.Helper()
+	ctx := context.Background()
+	err := f.rt.Pull(ctx, "alpine")
+	if err != nil {
+		f.t.Fatalf("Pull: %v", err)
+	}
+	id, err := f.rt.Create(ctx, &task.Config{Image: "alpine", Labels: labels})
+	if err != nil {
+		f.t.Fatalf("Create: %v", err)
+	}
+	if status == "created" {
+		return id
+	}
+	err = f.rt.Start(ctx, id)
+	if err != nil {
+		f.t.Fatalf("Start: %v", err)
+	}
+	if status == "exited" {
+		err = f.rt.Exit(id, code)
+		if err != nil {
+			f.t.Fatalf("Exit: %v", err)
+		}
+	}
+	return id
+}
+
+func TestReconcile(t *testing.T) {
+	const missing = task.State(-1)
+	tests := []struct {
+		name  string
+		setup func(f *reconcileFixture)
+		// want is the state of each task afterwards, missing if it isn't
+		// stored.
+		want                              map[string]task.State
+		recovered, updated, lost, orphans int
+		containers, running               int
+	}{
+		{
+			name: "in step",
+			setup: func(f *reconcileFixture) {
+				f.store("web", task.Running, f.container("web", "running", 0))
+			},
+			want:       map[string]task.State{"web": task.Running},
+			containers: 1,
+			running:    1,
+		},
+		{
+			name: "recovered from its container",
+			setup: func(f *reconcileFixture) {
+				f.container("web", "running", 0)
+			},
+			want:       map[string]task.State{"web": task.Running},
+			recovered:  1,
+			containers: 1,
+			running:    1,
+		},
+		{
+			name: "unknown container that never started",
+			setup: func(f *reconcileFixture) {
+				f.container("web", "created", 0)
+			},
+			want:    map[string]task.State{"web": missing},
+			orphans: 1,
+		},
+		{
+			name: "failed while the worker was down",
+			setup: func(f *reconcileFixture) {
+				f.store("web", task.Running, f.container("web", "exited", 3))
+			},
+			want:       map[string]task.State{"web": task.Failed},
+			updated:    1,
+			containers: 1,
+		},
+		{
+			name: "completed while the worker was down",
+			setup: func(f *reconcileFixture) {
+				f.store("web", task.Running, f.container("web", "exited", 0))
+			},
+			want:       map[string]task.State{"web": task.Completed},
+			updated:    1,
+			containers: 1,
+		},
+		{
+			name: "started before the worker recorded it",
+			setup: func(f *reconcileFixture) {
+				f.container("web", "running", 0)
+				f.store("web", task.Scheduled, "")
+			},
+			want:       map[string]task.State{"web": task.Running},
+			updated:    1,
+			containers: 1,
+			running:    1,
+		},
+		{
+			name: "lost containers",
+			setup: func(f *reconcileFixture) {
+				f.store("web", task.Running, "gone")
+				f.store("db", task.Scheduled, "")
+				f.store("done", task.Completed, "removed")
+			},
+			want:    map[string]task.State{"web": task.Failed, "db": task.Failed, "done": task.Completed},
+			lost:    2,
+			running: 0,
+		},
+		{
+			name: "finished task still running",
+			setup: func(f *reconcileFixture) {
+				f.store("web", task.Completed, f.container("web", "running", 0))
+			},
+			want:    map[string]task.State{"web": task.Completed},
+			orphans: 1,
+		},
+		{
+			name: "container without a task",
+			setup: func(f *reconcileFixture) {
+				f.labelled(map[string]string{WorkerLabel: "w1", TaskLabel: "not-a-task"}, "running", 0)
+			},
+			orphans: 1,
+		},
+		{
+			name: "two containers for one task",
+			setup: func(f *reconcileFixture) {
+				f.container("web", "running", 0)
+				f.container("web", "running", 0)
+				f.store("web", task.Running, "")
+			},
+			want:       map[string]task.State{"web": task.Running},
+			updated:    1,
+			orphans:    1,
+			containers: 1,
+			running:    1,
+		},
+		{
+			name: "another worker's containers",
+			setup: func(f *reconcileFixture) {
+				other := f.w.containerLabels(*f.task("web"))
+				other[WorkerLabel] = "w2"
+				f.labelled(other, "running", 0)
+			},
+			want:       map[string]task.State{"web": missing},
+			containers: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := task.NewFake()
+			w, err := New("w1", rt, store.MemoryType, "")
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			f := &reconcileFixture{t: t, w: w, rt: rt, tasks: make(map[string]*task.Task)}
+			tt.setup(f)
+
+			r, err := w.Reconcile(context.Background())
+			if err != nil {
+				t.Fatalf("Reconcile: %v", err)
+			}
+			if len(r.Recovered) != tt.recovered || len(r.Updated) != tt.updated ||
+				len(r.Lost) != tt.lost || len(r.Orphans) != tt.orphans {
+				t.Errorf("Reconcile: %v, want %d recovered, %d updated, %d lost, %d orphaned",
+					r, tt.recovered, tt.updated, tt.lost, tt.orphans)
+			}
+			for name, want := range tt.want {
+				if got := taskState(w, f.task(name).ID); got != want {
+					t.Errorf("task %s is %v, want %v", name, got, want)
+				}
+			}
+
+			containers, err := rt.List(context.Background(), nil)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if len(containers) != tt.containers {
+				t.Errorf("%d containers left, want %d", len(containers), tt.containers)
+			}
+			for _, c := range containers {
+				if c.Labels[WorkerLabel] != "w1" {
+					continue
+				}
+				stored, err := w.getTask(f.task("web").ID)
+				if err != nil || stored.ContainerID != c.ID {
+					t.Errorf("task web is not recorded with its container %v", c.ID)
+				}
+			}
+			if w.TaskCount != tt.running {
+				t.Errorf("TaskCount = %d, want %d", w.TaskCount, tt.running)
+			}
+		})
+	}
+}
@@ -1,54 +1,150 @@
 package worker
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/elimt/go-orchestrator/internal/stats"
+	"github.com/elimt/go-orchestrator/internal/store"
 	"github.com/elimt/go-orchestrator/internal/task"
-	"github.com/golang-collections/collections/queue"
 	"github.com/google/uuid"
 )
 
+const (
+	// DefaultConcurrency is the number of tasks a worker starts or stops at
+	// the same time unless configured otherwise.
+	DefaultConcurrency = 4
+	// DefaultTaskTimeout bounds how long starting or stopping a single task
+	// may take, including pulling its image.
+	DefaultTaskTimeout = 5 * time.Minute
+	// DefaultUpdateInterval is how often a worker checks its running tasks
+	// for exited containers.
+	DefaultUpdateInterval = 15 * time.Second
+)
+
 type Worker struct {
-	Name      string
-	Queue     queue.Queue
-	DB        map[uuid.UUID]*task.Task
-	TaskCount int
-	Stats     *Stats
+	Name        string
+	DB          store.Store
+	TaskCount   int
+	Stats       *stats.Stats
+	Runtime     task.Runtime
+	Concurrency int
+	TaskTimeout time.Duration
+	// UpdateInterval is how often UpdateTasks checks for exited containers.
+	UpdateInterval time.Duration
+	// Labels are advertised to the manager when the worker joins.
+	Labels map[string]string
+
+	// mu guards queue, inflight, TaskCount and Stats, and is held to update
+	// a stored task that may be finishing at the same time.
+	mu       sync.Mutex
+	queue    []task.Task
+	inflight map[uuid.UUID]context.CancelFunc
+	wake     chan struct{}
+
+	health map[uuid.UUID]*healthState
+}
+
+// New creates a worker that runs tasks on rt and keeps them in a store of
+// dbType. Persistent stores are written to dataDir.
+func New(name string, rt task.Runtime, dbType string, dataDir string) (*Worker, error) {
+	db, err := store.NewTaskStore(dbType, dataDir, fmt.Sprintf("%s_tasks.db", safeFileName(name)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create task store: %w", err)
+	}
+
+	w := Worker{
+		Name:           name,
+		DB:             db,
+		Runtime:        rt,
+		Concurrency:    DefaultConcurrency,
+		TaskTimeout:    DefaultTaskTimeout,
+		UpdateInterval: DefaultUpdateInterval,
+		inflight:       make(map[uuid.UUID]context.CancelFunc),
+		wake:           make(chan struct{}, 1),
+	}
+	for _, t := range w.GetTasks() {
+		if t.State == task.Running {
+			w.TaskCount++
+		}
+	}
+	return &w, nil
+}
+
+// safeFileName replaces the characters of a worker name, such as the colon
+// in a host:port pair, that don't belong in a file name.
+func safeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == ':' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+func (w *Worker) getTask(id uuid.UUID) (*task.Task, error) {
+	result, err := w.DB.Get(id.String())
+	if err != nil {
+		return nil, err
+	}
+	t, ok := result.(*task.Task)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert %v to task.Task", result)
+	}
+	return t, nil
+}
+
+func (w *Worker) putTask(t *task.Task) {
+	err := w.DB.Put(t.ID.String(), t)
+	if err != nil {
+		fmt.Printf("Error storing task %v: %v\n", t.ID, err)
+	}
 }
 
 func (w *Worker) CollectStats() {
 	for {
 		fmt.Println("Collecting stats")
-		w.Stats = GetStats()
-		w.TaskCount = w.Stats.TaskCount
+		s := stats.GetStats()
+		w.mu.Lock()
+		s.TaskCount = w.TaskCount
+		if w.Stats != nil {
+			s.PrevCPUStats = w.Stats.CPUStats
+		}
+		w.Stats = s
+		w.mu.Unlock()
 		time.Sleep(15 * time.Second)
 	}
 }
 
-func (w *Worker) runTask() task.DockerResult {
-	t := w.Queue.Dequeue()
-	if t == nil {
-		fmt.Println("No tasks in the queue")
-		return task.DockerResult{Error: nil}
-	}
-
-	taskQueued := t.(task.Task)
+// GetStats returns the stats most recently collected by CollectStats.
+func (w *Worker) GetStats() *stats.Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.Stats
+}
 
-	taskPersisted := w.DB[taskQueued.ID]
-	if taskPersisted == nil {
+func (w *Worker) runTask(ctx context.Context, taskQueued task.Task) task.DockerResult {
+	taskPersisted, err := w.getTask(taskQueued.ID)
+	if err != nil {
 		taskPersisted = &taskQueued
-		w.DB[taskQueued.ID] = &taskQueued
+		w.putTask(&taskQueued)
 	}
 
 	var result task.DockerResult
 	if task.ValidStateTransition(taskPersisted.State, taskQueued.State) {
 		switch taskQueued.State {
 		case task.Scheduled:
-			result = w.StartTask(taskQueued)
+			result = w.StartTask(ctx, taskQueued)
 		case task.Completed:
-			result = w.StopTask(taskQueued)
+			if taskQueued.ContainerID == "" {
+				taskQueued.ContainerID = taskPersisted.ContainerID
+			}
+			result = w.StopTask(ctx, taskQueued)
 		default:
 			result.Error = errors.New("we should not get here")
 		}
@@ -59,67 +155,233 @@ func (w *Worker) runTask() task.DockerResult {
 	return result
 }
 
+// RunTasks starts and stops queued tasks, running up to Concurrency of them
+// at once. Operations on the same task are never run concurrently: a task is
+// left in the queue until the previous operation on it has finished.
 func (w *Worker) RunTasks() {
+	concurrency := w.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+	sem := make(chan struct{}, concurrency)
+
 	for {
-		if w.Queue.Len() != 0 {
-			result := w.runTask()
+		sem <- struct{}{}
+		t, ctx, ok := w.nextTask()
+		if !ok {
+			<-sem
+			select {
+			case <-w.wake:
+			case <-time.After(10 * time.Second):
+			}
+			continue
+		}
+
+		go func(t task.Task) {
+			defer func() {
+				w.finishOperation(t.ID)
+				<-sem
+			}()
+
+			result := w.runTask(ctx, t)
 			if result.Error != nil {
-				fmt.Printf("Error running task: %v\n", result.Error)
+				fmt.Printf("Error running task %v: %v\n", t.ID, result.Error)
 			}
-		} else {
-			fmt.Printf("No tasks to process currently.\n")
+		}(t)
+	}
+}
+
+// nextTask takes the first queued task that has no operation in flight and
+// returns it with a context that is cancelled after TaskTimeout or when the
+// task is stopped.
+func (w *Worker) nextTask() (task.Task, context.Context, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for i, t := range w.queue {
+		ctx, ok := w.beginOperation(t.ID)
+		if !ok {
+			continue
+		}
+		w.queue = append(w.queue[:i], w.queue[i+1:]...)
+		return t, ctx, true
+	}
+	return task.Task{}, nil, false
+}
+
+// beginOperation marks an operation on the task as in flight, unless one
+// already is. Callers must hold w.mu and call finishOperation when done.
+func (w *Worker) beginOperation(id uuid.UUID) (context.Context, bool) {
+	if _, busy := w.inflight[id]; busy {
+		return nil, false
+	}
+
+	timeout := w.TaskTimeout
+	if timeout <= 0 {
+		timeout = DefaultTaskTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	w.inflight[id] = cancel
+	return ctx, true
+}
+
+func (w *Worker) finishOperation(id uuid.UUID) {
+	w.mu.Lock()
+	if cancel, ok := w.inflight[id]; ok {
+		cancel()
+		delete(w.inflight, id)
+	}
+	w.mu.Unlock()
+	w.signal()
+}
+
+// signal wakes RunTasks if it is waiting for work.
+func (w *Worker) signal() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// UpdateTasks periodically checks the runtime for tasks whose containers
+// have exited and records their final state.
+func (w *Worker) UpdateTasks() {
+	for {
+		fmt.Println("Checking status of tasks")
+		w.updateTasks()
+		fmt.Printf("Task updates completed, sleeping for %v\n", w.UpdateInterval)
+		time.Sleep(w.UpdateInterval)
+	}
+}
+
+func (w *Worker) updateTasks() {
+	for _, t := range w.GetTasks() {
+		if t.State != task.Running {
+			continue
+		}
+		id := t.ID
+
+		cs, err := w.Runtime.Inspect(context.Background(), t.ContainerID)
+		if err != nil {
+			fmt.Printf("Error inspecting container %v for task %v: %v\n", t.ContainerID, id, err)
+			t.State = task.Failed
+			w.finishTask(t)
+			continue
+		}
+
+		state := cs.TaskState()
+		if state == task.Completed || state == task.Failed {
+			fmt.Printf("Container %v for task %v exited with code %d\n", t.ContainerID, id, cs.ExitCode)
+			t.State = state
+			t.FinishTime = cs.FinishedAt
+			t.ExitCode = cs.ExitCode
+			w.finishTask(t)
 		}
-		fmt.Println("Sleeping for 10 seconds.")
-		time.Sleep(10 * time.Second)
 	}
+}
 
+// finishTask records a task that is no longer running and releases its
+// slot. It reports false, and records nothing, if the task was not running,
+// so that a task that exits while it is being stopped is counted once.
+func (w *Worker) finishTask(t *task.Task) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	persisted, err := w.getTask(t.ID)
+	if err != nil || persisted.State != task.Running {
+		return false
+	}
+	if t.FinishTime.IsZero() {
+		t.FinishTime = time.Now().UTC()
+	}
+	w.putTask(t)
+	if w.TaskCount > 0 {
+		w.TaskCount--
+	}
+	return true
 }
 
+// AddTask queues a task to be started or stopped. Stopping a task that is
+// still being started cancels the start.
 func (w *Worker) AddTask(t task.Task) {
-	w.Queue.Enqueue(t)
+	w.mu.Lock()
+	if cancel, ok := w.inflight[t.ID]; ok && t.State == task.Completed {
+		fmt.Printf("Cancelling in-flight operation on task %v\n", t.ID)
+		cancel()
+	}
+	w.queue = append(w.queue, t)
+	w.mu.Unlock()
+	w.signal()
 }
 
-func (w *Worker) StartTask(t task.Task) task.DockerResult {
+func (w *Worker) StartTask(ctx context.Context, t task.Task) task.DockerResult {
 	fmt.Println("I will start a task")
 	config := task.NewConfig(&t)
-	d := task.NewDocker(config)
-	result := d.Run()
+	config.Labels = w.containerLabels(t)
+	result := task.Run(ctx, w.Runtime, config)
 	if result.Error != nil {
 		fmt.Printf("Err running task %v: %v\n", t.ID, result.Error)
+		if result.ContainerID != "" {
+			cleanup := task.Stop(context.Background(), w.Runtime, result.ContainerID)
+			if cleanup.Error != nil {
+				fmt.Printf("Error removing container %v: %v\n", result.ContainerID, cleanup.Error)
+			}
+		}
 		t.State = task.Failed
-		w.DB[t.ID] = &t
+		w.putTask(&t)
 		return result
 	}
 
-	d.ContainerID = result.ContainerID
 	t.ContainerID = result.ContainerID
 	t.State = task.Running
-	w.DB[t.ID] = &t
+	t.StartTime = time.Now().UTC()
+	w.putTask(&t)
+	w.mu.Lock()
+	w.TaskCount++
+	w.mu.Unlock()
 
 	return result
 }
 
-func (w *Worker) StopTask(t task.Task) task.DockerResult {
+func (w *Worker) StopTask(ctx context.Context, t task.Task) task.DockerResult {
 	fmt.Println("I will stop a task")
-	config := task.NewConfig(&t)
-	d := task.NewDocker(config)
-
-	result := d.Stop()
+	result := task.Stop(ctx, w.Runtime, t.ContainerID)
 	if result.Error != nil {
-		fmt.Printf("Error stopping container %v: %v", d.ContainerID, result.Error)
+		fmt.Printf("Error stopping container %v: %v\n", t.ContainerID, result.Error)
 	}
 	t.FinishTime = time.Now().UTC()
 	t.State = task.Completed
-	w.DB[t.ID] = &t
-	fmt.Printf("Stopped and removed container %v for task %v", d.ContainerID, t.ID)
+	if !w.finishTask(&t) {
+		fmt.Printf("Removed container %v for task %v, which had already finished\n", t.ContainerID, t.ID)
+		return result
+	}
+	fmt.Printf("Stopped and removed container %v for task %v\n", t.ContainerID, t.ID)
 
 	return result
 }
 
+// Logs returns the output of the task's container.
+func (w *Worker) Logs(ctx context.Context, id uuid.UUID) (io.ReadCloser, error) {
+	t, err := w.getTask(id)
+	if err != nil {
+		return nil, err
+	}
+	if t.ContainerID == "" {
+		return nil, fmt.Errorf("task %v has no container", id)
+	}
+	return w.Runtime.Logs(ctx, t.ContainerID)
+}
+
 func (w *Worker) GetTasks() []*task.Task {
-	tasks := make([]*task.Task, 0)
-	for _, t := range w.DB {
-		tasks = append(tasks, t)
+	result, err := w.DB.List()
+	if err != nil {
+		fmt.Printf("Error getting list of tasks: %v\n", err)
+		return []*task.Task{}
+	}
+	tasks, ok := result.([]*task.Task)
+	if !ok {
+		fmt.Printf("Error converting %v to a list of tasks\n", result)
+		return []*task.Task{}
 	}
 	return tasks
 }
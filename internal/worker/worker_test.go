@@ -0,0 +1,215 @@
+package worker
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elimt/go-orchestrator/internal/store"
+	"github.com/elimt/go-orchestrator/internal/task"
+	"github.com/google/uuid"
+)
+
+// gatedRuntime is the Fake runtime with container starts held until
+// release is closed, recording the operations run and how many starts were
+// in flight at once. Held starts give up if their context is cancelled
+// when cancellable is set.
+type gatedRuntime struct {
+	*task.Fake
+	release     chan struct{}
+	cancellable bool
+
+	mu         sync.Mutex
+	starting   int
+	maxStarts  int
+	operations []string
+}
+
+func newGatedRuntime(cancellable bool) *gatedRuntime {
+	return &gatedRuntime{Fake: task.NewFake(), release: make(chan struct{}), cancellable: cancellable}
+}
+
+func (g *gatedRuntime) record(op string, delta int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if op != "" {
+		g.operations = append(g.operations, op)
+	}
+	g.starting += delta
+	if g.starting > g.maxStarts {
+		g.maxStarts = g.starting
+	}
+}
+
+func (g *gatedRuntime) Start(ctx context.Context, containerID string) error {
+	g.record("start", 1)
+	defer g.record("", -1)
+
+	if g.cancellable {
+		select {
+		case <-g.release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	} else {
+		<-g.release
+	}
+	return g.Fake.Start(ctx, containerID)
+}
+
+func (g *gatedRuntime) Stop(ctx context.Context, containerID string) error {
+	g.record("stop", 0)
+	return g.Fake.Stop(ctx, containerID)
+}
+
+// snapshot returns the starts in flight, the most there have been at once
+// and the operations run so far.
+func (g *gatedRuntime) snapshot() (int, int, []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.starting, g.maxStarts, append([]string(nil), g.operations...)
+}
+
+func newRunningWorker(t *testing.T, rt task.Runtime, concurrency int) *Worker {
+	t.Helper()
+	w, err := New("w1", rt, store.MemoryType, "")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	w.Concurrency = concurrency
+	go w.RunTasks()
+	return w
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// taskState returns the stored state of task id, or -1 if it isn't stored.
+func taskState(w *Worker, id uuid.UUID) task.State {
+	t, err := w.getTask(id)
+	if err != nil {
+		return -1
+	}
+	return t.State
+}
+
+func TestRunTasksConcurrency(t *testing.T) {
+	rt := newGatedRuntime(false)
+	w := newRunningWorker(t, rt, 2)
+
+	var ids []uuid.UUID
+	for i := 0; i < 5; i++ {
+		tk := task.Task{ID: uuid.New(), Image: "alpine", State: task.Scheduled}
+		ids = append(ids, tk.ID)
+		w.AddTask(tk)
+	}
+
+	waitFor(t, "two starts", func() bool {
+		starting, _, _ := rt.snapshot()
+		return starting == 2
+	})
+	// Give a third start the chance to begin if the limit didn't hold.
+	time.Sleep(50 * time.Millisecond)
+	if _, most, _ := rt.snapshot(); most != 2 {
+		t.Fatalf("%d starts in flight, want 2", most)
+	}
+
+	close(rt.release)
+	waitFor(t, "every task to run", func() bool {
+		for _, id := range ids {
+			if taskState(w, id) != task.Running {
+				return false
+			}
+		}
+		return true
+	})
+	if _, most, _ := rt.snapshot(); most > 2 {
+		t.Errorf("%d starts were in flight at once, want at most 2", most)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.TaskCount != len(ids) {
+		t.Errorf("TaskCount = %d, want %d", w.TaskCount, len(ids))
+	}
+}
+
+func TestRunTasksStopWaitsForStart(t *testing.T) {
+	rt := newGatedRuntime(false)
+	w := newRunningWorker(t, rt, 4)
+
+	tk := task.Task{ID: uuid.New(), Image: "alpine", State: task.Scheduled}
+	w.AddTask(tk)
+	waitFor(t, "the start", func() bool {
+		starting, _, _ := rt.snapshot()
+		return starting == 1
+	})
+
+	stop := tk
+	stop.State = task.Completed
+	w.AddTask(stop)
+	// Spare slots must not run the stop alongside the start.
+	time.Sleep(50 * time.Millisecond)
+	if _, _, ops := rt.snapshot(); len(ops) != 1 {
+		t.Fatalf("operations %v ran while the start was in flight, want only the start", ops)
+	}
+
+	close(rt.release)
+	waitFor(t, "the task to stop", func() bool {
+		return taskState(w, tk.ID) == task.Completed
+	})
+	if _, _, ops := rt.snapshot(); !reflect.DeepEqual(ops, []string{"start", "stop"}) {
+		t.Errorf("operations %v, want the start then the stop", ops)
+	}
+	checkStopped(t, w, rt)
+}
+
+func TestRunTasksStopCancelsStart(t *testing.T) {
+	rt := newGatedRuntime(true)
+	w := newRunningWorker(t, rt, 4)
+
+	tk := task.Task{ID: uuid.New(), Image: "alpine", State: task.Scheduled}
+	w.AddTask(tk)
+	waitFor(t, "the start", func() bool {
+		starting, _, _ := rt.snapshot()
+		return starting == 1
+	})
+
+	// The start is never released, so only the stop can end it.
+	stop := tk
+	stop.State = task.Completed
+	w.AddTask(stop)
+	waitFor(t, "the start to fail", func() bool {
+		return taskState(w, tk.ID) == task.Failed
+	})
+	waitFor(t, "the queue to drain", func() bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return len(w.queue) == 0 && len(w.inflight) == 0
+	})
+	checkStopped(t, w, rt)
+}
+
+// checkStopped checks that the worker has no containers or running tasks
+// left.
+func checkStopped(t *testing.T, w *Worker, rt task.Runtime) {
+	t.Helper()
+	if containers, _ := rt.List(context.Background(), nil); len(containers) != 0 {
+		t.Errorf("%d containers left, want none", len(containers))
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.TaskCount != 0 {
+		t.Errorf("TaskCount = %d, want 0", w.TaskCount)
+	}
+}